@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Card files add vanilla cards, whose effects are all in their list
+// entries, and presets. Each file in the directory is an expansion. A
+// text file, ending in .txt, holds lines as in CardDB.List, and presets
+// as in CardDB.Presets:
+//
+//	# Cards of our own.
+//	Peddler,8,Action,+C1,+A1,$1
+//	Sprawl:Peddler,Village,Smithy,Market,Militia,Moat,Cellar,Mine,Remodel,Workshop
+//
+// The expansion is named after the file. A JSON file, ending in .json,
+// holds a cardFile. Files are read in order of name, so a preset may use
+// cards from files before it. Terminal clients need the same files.
+type cardFile struct {
+	Name  string // Of the expansion; if empty, that of the file.
+	Cards []struct {
+		Name                 string
+		Cost                 int
+		Kinds                []string
+		Coins, VP            int
+		Cards, Actions, Buys int // +Cards, +Actions and +Buys.
+	}
+	Presets []struct {
+		Name  string
+		Cards []string
+	}
+}
+
+// Kinds a card without code may have.
+var vanillaKinds = []string{"Action", "Treasure", "Victory"}
+
+// readCards loads the card files in dir.
+func readCards(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := filepath.Join(dir, e.Name())
+		ext := filepath.Ext(name)
+		if e.IsDir() || ext != ".txt" && ext != ".json" {
+			continue
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		db := CardDB{Name: strings.TrimSuffix(e.Name(), ext)}
+		if ext == ".json" {
+			err = db.parseJSON(b)
+		} else {
+			err = db.parseText(b)
+		}
+		if err == nil {
+			err = loadFileDB(db)
+		}
+		if err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// parseText fills db from a text card file.
+func (db *CardDB) parseText(b []byte) error {
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var err error
+		if v := strings.SplitN(line, ":", 2); len(v) == 2 {
+			err = db.addPreset(v[0], strings.Split(v[1], ","))
+		} else {
+			err = db.addCard(strings.Split(line, ","))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseJSON fills db from a JSON card file.
+func (db *CardDB) parseJSON(b []byte) error {
+	var f cardFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return err
+	}
+	if f.Name != "" {
+		db.Name = f.Name
+	}
+	for _, c := range f.Cards {
+		v := []string{c.Name, fmt.Sprint(c.Cost), strings.Join(c.Kinds, "-")}
+		for _, x := range []struct {
+			prefix string
+			n      int
+		}{{"$", c.Coins}, {"#", c.VP}, {"+A", c.Actions}, {"+B", c.Buys}, {"+C", c.Cards}} {
+			if x.n != 0 {
+				v = append(v, fmt.Sprint(x.prefix, x.n))
+			}
+		}
+		if err := db.addCard(v); err != nil {
+			return err
+		}
+	}
+	for _, pr := range f.Presets {
+		if err := db.addPreset(pr.Name, pr.Cards); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addCard adds the list entry with the given fields, checking what
+// loadDB would panic over.
+func (db *CardDB) addCard(v []string) error {
+	for i := range v {
+		v[i] = strings.TrimSpace(v[i])
+	}
+	if len(v) < 3 || v[0] == "" || strings.ContainsAny(v[0], ",:") {
+		return fmt.Errorf("bad card: %q", strings.Join(v, ","))
+	}
+	if _, ok := CardDict[v[0]]; ok || strings.Contains(db.List, "\n"+v[0]+",") {
+		return fmt.Errorf("%v: card exists", v[0])
+	}
+	for _, s := range strings.Split(v[2], "-") {
+		if !nameIn(s, vanillaKinds) {
+			return fmt.Errorf("%v: kind %q needs code", v[0], s)
+		}
+	}
+	db.List += "\n" + strings.Join(v, ",")
+	return nil
+}
+
+// addPreset adds a preset of 10 kingdom cards.
+func (db *CardDB) addPreset(name string, cards []string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, ":\n") {
+		return fmt.Errorf("bad preset name: %q", name)
+	}
+	if findPreset(name) != nil || strings.Contains("\n"+db.Presets, "\n"+name+":") {
+		return fmt.Errorf("%v: preset exists", name)
+	}
+	if len(cards) != 10 {
+		return fmt.Errorf("%v: want 10 cards, got %v", name, len(cards))
+	}
+	for i := range cards {
+		cards[i] = strings.TrimSpace(cards[i])
+		if nameIn(cards[i], basicCards) || nameIn(cards[i], cards[:i]) {
+			return fmt.Errorf("%v: bad card %q", name, cards[i])
+		}
+	}
+	db.Presets += name + ":" + strings.Join(cards, ",") + "\n"
+	return nil
+}
+
+// loadFileDB is loadDB, returning an error rather than panicking over a
+// bad entry.
+func loadFileDB(db CardDB) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("bad entry: %v", r)
+		}
+	}()
+	loadDB(db)
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCardFiles(t *testing.T) {
+	nCards, nPresets, nSets := len(CardDict), len(presets), len(cardSets)
+	t.Cleanup(func() {
+		delete(CardDict, "Test Peddler")
+		delete(CardDict, "Test Manor")
+		presets, cardSets = presets[:nPresets], cardSets[:nSets]
+	})
+	dir := t.TempDir()
+	write := func(name, text string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.txt", `
+# A comment.
+Test Peddler, 8, Action, +C1, +A1, $1
+Peddling:Test Peddler,Village,Smithy,Market,Militia,Moat,Cellar,Mine,Remodel,Workshop
+`)
+	write("b.json", `{
+	"Name": "Homebrew",
+	"Cards": [{"Name": "Test Manor", "Cost": 3, "Kinds": ["Victory"], "VP": 2}],
+	"Presets": [{"Name": "Manors", "Cards": ["Test Manor", "Test Peddler", "Village", "Smithy", "Market", "Militia", "Moat", "Cellar", "Mine", "Remodel"]}]
+}`)
+	write("notes.md", "Not cards.")
+	if err := readCards(dir); err != nil {
+		t.Fatal(err)
+	}
+	if len(CardDict) != nCards+2 {
+		t.Errorf("want 2 cards more, got %v", len(CardDict)-nCards)
+	}
+	peddler := GetCard("Test Peddler")
+	if peddler.cost != 8 || !peddler.IsAction() || peddler.cards != 1 || peddler.actions != 1 || peddler.coin != 1 || peddler.set != "a" {
+		t.Errorf("bad Test Peddler: %+v", *peddler)
+	}
+	manor := GetCard("Test Manor")
+	if !manor.IsVictory() || manor.vp(nil) != 2 || manor.set != "Homebrew" {
+		t.Errorf("bad Test Manor: %+v", *manor)
+	}
+	if pr := findPreset("Manors"); pr == nil || len(pr.cards) != 10 || findPreset("Peddling") == nil {
+		t.Error("presets not loaded")
+	}
+
+	for _, text := range []string{
+		"Test Haven,2,Action-Duration,+C1",
+		"Village,3,Action,+C1,+A2",
+		"Test Bad,x,Action",
+		"Short:Village,Smithy",
+		"Unknown:Test Nothing,Village,Smithy,Market,Militia,Moat,Cellar,Mine,Remodel,Workshop",
+	} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "c.txt"), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := readCards(dir); err == nil {
+			t.Errorf("%q: want error", text)
+		}
+	}
+}
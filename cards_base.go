@@ -1,10 +1,7 @@
 package main
 
-import (
-	"fmt"
-)
-
 var cardsBase = CardDB{
+	Name: "Base",
 	List: `
 Copper,0,Treasure,$1
 Silver,3,Treasure,$2
@@ -52,7 +49,7 @@ Adventurer,6,Action
 			p := game.p
 			if len(p.deck) > 0 && game.getBool(p, "discard deck?") {
 				p.discard.Add(p.deck...)
-				game.Report(Event{s: "discarddeck", n: p.n, i: len(p.deck)})
+				game.reportDiscard(p, len(p.deck), true)
 				p.deck = nil
 			}
 		},
@@ -65,7 +62,7 @@ Adventurer,6,Action
 					game.revealHand(other)
 					return
 				}
-				fmt.Printf("%v decks %v\n", other.name, selected[0].name)
+				game.Printf("%v decks %v\n", other.name, selected[0].name)
 				other.deck = append(selected, other.deck...)
 			})
 		},
@@ -104,11 +101,11 @@ Adventurer,6,Action
 		"Spy": func(game *Game) {
 			p := game.p
 			game.attack(func(other *Player) {
-				if !other.MaybeShuffle() {
+				if !game.MaybeShuffle(other) {
 					return
 				}
 				c := game.reveal(other)
-				if game.getBool(p, "discard?") {
+				if game.getBool(p, "discard?", c) {
 					game.DiscardList(other, Pile{c})
 					other.deck = other.deck[1:]
 				}
@@ -118,7 +115,7 @@ Adventurer,6,Action
 			p := game.p
 			game.attack(func(other *Player) {
 				var loot, junk Pile
-				for i := 0; i < 2 && other.MaybeShuffle(); i++ {
+				for i := 0; i < 2 && game.MaybeShuffle(other); i++ {
 					c := game.reveal(other)
 					other.deck = other.deck[1:]
 					if c.IsTreasure() {
@@ -135,7 +132,7 @@ Adventurer,6,Action
 				if len(loot) > 0 {
 					c := loot[0]
 					game.TrashCard(other, c)
-					if c.supply > 0 && game.getBool(p, "gain "+c.name+"?") {
+					if game.supply[c] > 0 && game.getBool(p, "gain "+c.name+"?", c) {
 						game.panickyGain(p, c)
 					}
 				}
@@ -158,24 +155,20 @@ Adventurer,6,Action
 				mustAsk := false
 				if game.isServer {
 					c := p.hand[len(p.hand)-1]
-					cmd := "done"
-					if c.IsAction() {
-						mustAsk = true
-						cmd = "yes"
-					}
-					game.cast("library", cmd)
+					mustAsk = c.IsAction()
+					game.cast(message{Type: "library", Yes: mustAsk})
 				} else {
-					mustAsk = game.fetch()[0] == "yes"
+					mustAsk = game.fetch().Yes
 				}
 				if mustAsk && game.getBool(p, "set aside?") {
 					var c *Card
 					if game.isServer {
 						c = p.hand[len(p.hand)-1]
-						game.cast("library2", c)
+						game.cast(cardMessage("library2", c))
 					} else {
-						c = game.keyToCard(game.fetch()[0][0])
+						c = game.fetch().card()
 					}
-					fmt.Printf("%v sets aside %v\n", p.name, c.name)
+					game.Printf("%v sets aside %v\n", p.name, c.name)
 					p.hand = p.hand[:len(p.hand)-1]
 					v.Add(c)
 				}
@@ -196,7 +189,7 @@ Adventurer,6,Action
 			}
 			game.TrashCard(p, selected[0])
 			choice := pickGainCond(game, game.Cost(selected[0])+3, f)
-			fmt.Printf("%v puts %v into hand\n", p.name, choice.name)
+			game.Printf("%v puts %v into hand\n", p.name, choice.name)
 			p.hand.Add(choice)
 			p.discard = p.discard[:len(p.discard)-1]
 		},
@@ -205,17 +198,21 @@ Adventurer,6,Action
 		},
 		"Adventurer": func(game *Game) {
 			p := game.p
-			for n := 2; n > 0 && p.MaybeShuffle(); {
+			// Other cards are set aside until the end, so they are not
+			// shuffled into the deck and revealed again.
+			var aside Pile
+			for n := 2; n > 0 && game.MaybeShuffle(p); {
 				c := game.reveal(p)
 				if c.IsTreasure() {
-					fmt.Printf("%v puts %v in hand\n", p.name, c.name)
+					game.Printf("%v puts %v in hand\n", p.name, c.name)
 					p.hand.Add(c)
 					n--
 				} else {
-					game.DiscardList(p, Pile{c})
+					aside.Add(c)
 				}
 				p.deck = p.deck[1:]
 			}
+			game.DiscardList(p, aside)
 		},
 	},
 	VP: map[string]func(*Game) int{
@@ -27,7 +27,7 @@ hand:Moat
 	}
 	game.NewGame()
 	// Alice plays Bureaucrat.
-	GetCard("Silver").supply = 8
+	game.supply = map[*Card]int{GetCard("Silver"): 8}
 	game.StartTurn(0)
 	game.phase = phAction
 	done := make(chan bool)
@@ -68,7 +68,7 @@ deck:Estate
 hand:Moat
 `)
 	// Carol plays Witch.
-	GetCard("Curse").supply = 3
+	game.supply = map[*Card]int{GetCard("Curse"): 3}
 	game.p = players[2]
 	go func() {
 		// Eve abstains from revealing Moat(!)
@@ -119,10 +119,12 @@ hand:Throne Room,Throne Room,Feast,Feast,Spy
 	game.phase = phAction
 	done := make(chan bool)
 	game.suplist = append(game.suplist, GetCard("Village"), GetCard("Militia"), GetCard("Market"), GetCard("Adventurer"))
-	GetCard("Village").supply = 1
-	GetCard("Militia").supply = 1
-	GetCard("Market").supply = 10
-	GetCard("Adventurer").supply = 10
+	game.supply = map[*Card]int{
+		GetCard("Village"):    1,
+		GetCard("Militia"):    1,
+		GetCard("Market"):     10,
+		GetCard("Adventurer"): 10,
+	}
 	go func() {
 		<-players[0].trigger
 		game.ch <- Command{s: "pick", c: GetCard("Throne Room")}
@@ -153,3 +155,29 @@ discard:Market,Village,Militia,Market
 		t.Errorf(msg)
 	}
 }
+
+func TestAdventurer(t *testing.T) {
+	players := Setup(t, `
+= Alice =
+hand:Adventurer
+deck:Estate,Copper,Duchy
+discard:Estate
+`)
+	game := &Game{ch: make(chan Command), isServer: true,
+		sendCmd:    func(game *Game, p *Player, cmd *Command) {},
+		GetDiscard: func(game *Game, p *Player) string { return p.discard[len(p.discard)-1].name },
+		players:    players,
+	}
+	game.NewGame()
+	game.StartTurn(0)
+	game.phase = phAction
+	// Only one treasure is left, and the cards revealed are not shuffled
+	// back in to be revealed again.
+	game.Play(GetCard("Adventurer"))
+	CheckPiles(t, players, `
+= Alice =
+hand:Copper
+played:Adventurer
+discard:Estate,Duchy,Estate
+`)
+}
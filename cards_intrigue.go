@@ -5,6 +5,7 @@ import (
 )
 
 var cardsIntrigue = CardDB{
+	Name: "Intrigue",
 	List: `
 Courtyard,2,Action,+C3
 Pawn,2,Action
@@ -36,7 +37,7 @@ Nobles,6,Action-Victory,#2
 		"Courtyard": func(game *Game) {
 			p := game.p
 			for _, c := range game.pickHand(p, "1") {
-				fmt.Printf("%v decks a card\n", p.name)
+				game.Printf("%v decks a card\n", p.name)
 				p.deck = append(Pile{c}, p.deck...)
 			}
 		},
@@ -61,6 +62,10 @@ Nobles,6,Action-Victory,#2
 				}
 			}
 			for i := 0; i < m; i++ {
+				if a[i] == nil {
+					// Nothing to pass.
+					continue
+				}
 				j := (i + 1) % m
 				left := game.players[j]
 				left.hand.Add(a[i])
@@ -85,7 +90,7 @@ Nobles,6,Action-Victory,#2
 		},
 		"Swindler": func(game *Game) {
 			game.attack(func(other *Player) {
-				if !other.MaybeShuffle() {
+				if !game.MaybeShuffle(other) {
 					return
 				}
 				c := game.reveal(other)
@@ -96,12 +101,12 @@ Nobles,6,Action-Victory,#2
 		},
 		"Wishing Well": func(game *Game) {
 			p := game.p
-			if !p.MaybeShuffle() {
+			if !game.MaybeShuffle(p) {
 				return
 			}
 			c := pickCard(game, p, CardOpts{any: true})
 			if c == game.reveal(p) {
-				fmt.Printf("%v puts %v in hand\n", p.name, c.name)
+				game.Printf("%v puts %v in hand\n", p.name, c.name)
 				p.hand.Add(c)
 				p.deck = p.deck[1:]
 			}
@@ -149,10 +154,10 @@ Nobles,6,Action-Victory,#2
 		"Scout": func(game *Game) {
 			p := game.p
 			var v Pile
-			for n := 0; n < 4 && p.MaybeShuffle(); n++ {
+			for n := 0; n < 4 && game.MaybeShuffle(p); n++ {
 				c := game.reveal(p)
 				if c.IsVictory() {
-					fmt.Printf("%v puts %v in hand\n", p.name, c.name)
+					game.Printf("%v puts %v in hand\n", p.name, c.name)
 					p.hand.Add(c)
 				} else {
 					v.Add(c)
@@ -162,7 +167,7 @@ Nobles,6,Action-Victory,#2
 			for len(v) > 0 {
 				var selected Pile
 				selected, v = game.split(v, p, "1")
-				fmt.Printf("%v decks %v\n", p.name, selected[0].name)
+				game.Printf("%v decks %v\n", p.name, selected[0].name)
 				p.deck = append(selected, p.deck...)
 			}
 		},
@@ -188,7 +193,7 @@ Nobles,6,Action-Victory,#2
 			game.attack(func(other *Player) {
 				var v Pile
 				var c *Card
-				for other.MaybeShuffle() {
+				for game.MaybeShuffle(other) {
 					c = game.reveal(other)
 					other.deck = other.deck[1:]
 					if game.Cost(c) >= 3 {
@@ -280,7 +285,7 @@ Nobles,6,Action-Victory,#2
 		"Secret Chamber": func(game *Game, p *Player) {
 			game.draw(p, 2)
 			selected := game.pickHand(p, "2")
-			fmt.Printf("%v decks %v cards\n", p.name, len(selected))
+			game.Printf("%v decks %v cards\n", p.name, len(selected))
 			p.deck = append(selected, p.deck...)
 		},
 	},
@@ -303,23 +308,38 @@ type NameFun struct {
 
 func (game *Game) Choose(p *Player, n int, nfs []NameFun) {
 	for i, nf := range nfs {
-		fmt.Printf("[%d] %v\n", i+1, nf.name)
+		game.Printf("[%d] %v\n", i+1, nf.name)
 	}
 	var selection []int
 	game.SetParse(fmt.Sprintf("Choose %v:", n), func(b byte) (Command, string) {
 		if b < '1' || b > '0'+byte(len(nfs)) {
-			i := int(b - '1')
-			for _, x := range selection {
-				if x == i {
-					return errCmd, "already chosen " + string(b)
-				}
-			}
 			return errCmd, "enter digit within range"
 		}
+		for _, x := range selection {
+			if x == int(b-'1') {
+				return errCmd, "already chosen " + string(b)
+			}
+		}
 		return Command{s: string(b)}, ""
 	})
+	check := func(cmd Command) string {
+		if len(cmd.s) != 1 || cmd.s[0] < '1' || cmd.s[0] > '0'+byte(len(nfs)) {
+			return "bad choice: " + cmd.s
+		}
+		for _, x := range selection {
+			if x == int(cmd.s[0]-'1') {
+				return "already chosen " + cmd.s
+			}
+		}
+		return ""
+	}
+	d := &Decision{kind: decChoose, prompt: fmt.Sprintf("Choose %v:", n), n: n}
+	for _, nf := range nfs {
+		d.names = append(d.names, nf.name)
+	}
+	game.ask(d)
 	for len(selection) < n {
-		selection = append(selection, int(game.getCommand(p).s[0]-'1'))
+		selection = append(selection, int(game.getCommand(p, check).s[0]-'1'))
 	}
 	for _, v := range selection {
 		nfs[v].fun()
@@ -4,29 +4,35 @@ import (
 	"fmt"
 )
 
-func (game *Game) addDuration(fun func()) {
+// A Duration is a card whose effect resumes at the start of its owner's
+// next turn, along with any cards it set aside.
+type Duration struct {
+	card *Card
+	set  Pile
+}
+
+// addDuration schedules the next-turn effect of the card being played.
+func (game *Game) addDuration(set Pile) {
 	key := "Duration/" + game.p.name
-	var list []func()
-	if v, ok := game.data[key].([]func()); ok {
+	var list []Duration
+	if v, ok := game.data[key].([]Duration); ok {
 		list = v
 	}
-	game.data[key] = append(list, fun)
+	game.data[key] = append(list, Duration{game.StackTop().card, set})
 }
 func (game *Game) peek(c *Card) *Card {
 	p := game.p
+	game.hide()
 	if game.isServer {
-		game.castCond(func(x *Player) bool { return x == p }, "peek", c)
-		game.castCond(func(x *Player) bool { return x != p }, "peek", "?")
+		game.castCond(func(x *Player) bool { return x == p }, cardMessage("peek", c))
+		game.castCond(func(x *Player) bool { return x != p }, cardMessage("peek", nil))
 		return c
 	}
-	key := game.fetch()[0][0]
-	if key != '?' {
-		return game.keyToCard(key)
-	}
-	return nil
+	return game.fetch().card()
 }
 
 var cardsSeaside = CardDB{
+	Name: "Seaside",
 	List: `
 Embargo,2,Action,$2
 Haven,2,Action-Duration,+C1,+A1
@@ -67,22 +73,18 @@ Wharf,5,Action-Duration,+C2,+B1
 			if len(selected) == 0 {
 				return
 			}
-			game.addDuration(func() { p.hand.Add(selected...) })
+			game.addDuration(selected)
 		},
 		"Lighthouse": func(game *Game) {
-			key := "Lighthouse/" + game.p.name
-			game.data[key] = true
-			game.addDuration(func() {
-				game.addCoins(1)
-				delete(game.data, key)
-			})
+			game.data["Lighthouse/"+game.p.name] = true
+			game.addDuration(nil)
 		},
 		"Native Village": func(game *Game) {
 			p := game.p
 			key := "Native Village/" + p.name
 			game.Choose(p, 1, []NameFun{
 				{"Set aside top card to Native Village", func() {
-					if !p.MaybeShuffle() {
+					if !game.MaybeShuffle(p) {
 						return
 					}
 					c := p.deck[0]
@@ -104,37 +106,32 @@ Wharf,5,Action-Duration,+C2,+B1
 		},
 		"Pearl Diver": func(game *Game) {
 			p := game.p
-			if !p.MaybeShuffle() {
+			if !game.MaybeShuffle(p) {
 				return
 			}
 			c := game.peek(p.deck[len(p.deck)-1])
 			if c == nil {
-				fmt.Printf("%v looks at bottom card\n", p.name)
+				game.Printf("%v looks at bottom card\n", p.name)
 			} else {
-				fmt.Printf("%v looks at %v\n", p.name, c.name)
+				game.Printf("%v looks at %v\n", p.name, c.name)
 			}
-			if game.getBool(game.p, "move to top?") {
+			if game.getBool(game.p, "move to top?", c) {
 				p.deck = append(Pile{c}, p.deck[:len(p.deck)-1]...)
 			}
 		},
-		"Fishing Village": func(game *Game) {
-			game.addDuration(func() {
-				game.addActions(1)
-				game.addCoins(1)
-			})
-		},
+		"Fishing Village": func(game *Game) { game.addDuration(nil) },
 		"Lookout": func(game *Game) {
 			p := game.p
 			var v Pile
 			for i := 0; i < 3; i++ {
-				if !p.MaybeShuffle() {
+				if !game.MaybeShuffle(p) {
 					break
 				}
 				c := game.peek(p.deck[0])
 				if c == nil {
-					fmt.Printf("%v looks at card #%v\n", p.name, i+1)
+					game.Printf("%v looks at card #%v\n", p.name, i+1)
 				} else {
-					fmt.Printf("%v looks at [%c] %v\n", p.name, c.key, c.name)
+					game.Printf("%v looks at [%c] %v\n", p.name, game.keys[c], c.name)
 				}
 				v.Add(c)
 				p.deck = p.deck[1:]
@@ -160,7 +157,7 @@ Wharf,5,Action-Duration,+C2,+B1
 			if x, ok := game.data[key]; ok {
 				p := game.p
 				for _, c := range x.(Pile) {
-					fmt.Printf("[%c] %v\n", c.key, c.name)
+					game.Printf("[%c] %v\n", game.keys[c], c.name)
 				}
 				selected, _ := game.split(x.(Pile), p, "1")
 				for _, c := range selected {
@@ -169,7 +166,7 @@ Wharf,5,Action-Duration,+C2,+B1
 			}
 		},
 		"Warehouse": func(game *Game) { game.DiscardList(game.p, game.pickHand(game.p, "3")) },
-		"Caravan":   func(game *Game) { game.addDuration(func() { game.addCards(1) }) },
+		"Caravan":   func(game *Game) { game.addDuration(nil) },
 		"Cutpurse": func(game *Game) {
 			game.attack(func(other *Player) {
 				selected := game.pickHand(other, "1,card Copper")
@@ -191,7 +188,7 @@ Wharf,5,Action-Duration,+C2,+B1
 			frame.popHook = func() { aside.Add(frame.card) }
 			selected := game.pickHand(p, "1")
 			if len(selected) > 0 {
-				fmt.Printf("%v sets aside %v\n", p.name, selected[0].name)
+				game.Printf("%v sets aside %v\n", p.name, selected[0].name)
 				aside.Add(selected[0])
 			}
 			game.data[key] = aside
@@ -200,14 +197,14 @@ Wharf,5,Action-Duration,+C2,+B1
 			p := game.p
 			var v Pile
 			for i := 0; i < 5; i++ {
-				if !p.MaybeShuffle() {
+				if !game.MaybeShuffle(p) {
 					break
 				}
 				c := game.peek(p.deck[0])
 				if c == nil {
-					fmt.Printf("%v looks at #%v\n", p.name, i+1)
+					game.Printf("%v looks at #%v\n", p.name, i+1)
 				} else {
-					fmt.Printf("%v looks at [%c] %v\n", p.name, c.key, c.name)
+					game.Printf("%v looks at [%c] %v\n", p.name, game.keys[c], c.name)
 				}
 				v.Add(c)
 				p.deck = p.deck[1:]
@@ -215,7 +212,7 @@ Wharf,5,Action-Duration,+C2,+B1
 			if len(v) == 0 {
 				return
 			}
-			if game.getBool(game.p, "discard?") {
+			if game.getBool(game.p, "discard?", v...) {
 				game.DiscardList(p, v)
 				return
 			}
@@ -238,7 +235,7 @@ Wharf,5,Action-Duration,+C2,+B1
 					var loot, junk Pile
 					var found bool
 					game.attack(func(other *Player) {
-						for i := 0; i < 2 && other.MaybeShuffle(); i++ {
+						for i := 0; i < 2 && game.MaybeShuffle(other); i++ {
 							c := game.reveal(other)
 							other.deck = other.deck[1:]
 							if c.IsTreasure() {
@@ -274,7 +271,7 @@ Wharf,5,Action-Duration,+C2,+B1
 		},
 		"Sea Hag": func(game *Game) {
 			game.attack(func(other *Player) {
-				if other.MaybeShuffle() {
+				if game.MaybeShuffle(other) {
 					game.DiscardList(other, other.deck[:1])
 					other.deck = other.deck[1:]
 				}
@@ -316,7 +313,7 @@ Wharf,5,Action-Duration,+C2,+B1
 				other.deck = append(selected, other.deck...)
 			})
 		},
-		"Merchant Ship": func(game *Game) { game.addDuration(func() { game.addCoins(2) }) },
+		"Merchant Ship": func(game *Game) { game.addDuration(nil) },
 		"Tactician": func(game *Game) {
 			p := game.p
 			if len(p.hand) == 0 {
@@ -324,17 +321,30 @@ Wharf,5,Action-Duration,+C2,+B1
 			}
 			game.DiscardList(p, p.hand)
 			p.hand = nil
-			game.addDuration(func() {
-				game.addCards(5)
-				game.addBuys(1)
-				game.addActions(1)
-			})
+			game.addDuration(nil)
 		},
-		"Wharf": func(game *Game) {
-			game.addDuration(func() {
-				game.addCards(2)
-				game.addBuys(1)
-			})
+		"Wharf": func(game *Game) { game.addDuration(nil) },
+	},
+	Duration: map[string]func(*Game, Pile){
+		"Haven": func(game *Game, set Pile) { game.p.hand.Add(set...) },
+		"Lighthouse": func(game *Game, set Pile) {
+			game.addCoins(1)
+			delete(game.data, "Lighthouse/"+game.p.name)
+		},
+		"Fishing Village": func(game *Game, set Pile) {
+			game.addActions(1)
+			game.addCoins(1)
+		},
+		"Caravan":       func(game *Game, set Pile) { game.addCards(1) },
+		"Merchant Ship": func(game *Game, set Pile) { game.addCoins(2) },
+		"Tactician": func(game *Game, set Pile) {
+			game.addCards(5)
+			game.addBuys(1)
+			game.addActions(1)
+		},
+		"Wharf": func(game *Game, set Pile) {
+			game.addCards(2)
+			game.addBuys(1)
 		},
 	},
 	Setup: func() {
@@ -354,16 +364,16 @@ Wharf,5,Action-Duration,+C2,+B1
 		})
 		HookTurn(func(game *Game) {
 			key := "Duration/" + game.p.name
-			if v, ok := game.data[key].([]func()); ok {
-				for _, f := range v {
-					f()
+			if v, ok := game.data[key].([]Duration); ok {
+				for _, d := range v {
+					d.card.duration(game, d.set)
 				}
 			}
 			delete(game.data, key)
 
 			delete(game.data, "Treasury")
 
-			delete(game.data, "Smugglers/" + game.p.name)
+			delete(game.data, "Smugglers/"+game.p.name)
 		})
 		HookClean(func(game *Game, c *Card) {
 			if c == GetCard("Treasury") {
@@ -382,7 +392,7 @@ Wharf,5,Action-Duration,+C2,+B1
 		HookAttack(func(game *Game) {
 			key := "Lighthouse/" + game.p.name
 			if _, ok := game.data[key].([]func()); ok {
-				fmt.Printf("%v: Lighthouse stops attack", game.p.name)
+				game.Printf("%v: Lighthouse stops attack", game.p.name)
 				game.noAttack = true
 			}
 		})
@@ -1,53 +1,137 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"math/rand"
 	"net/http"
-	"regexp"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
-func client(host string) {
-	p := &Player{fun: consoleGamer{}, herald: make(chan Event), trigger: make(chan bool)}
-	rand.Seed(time.Now().Unix())
-	for i := 0; i < 3; i++ {
-		p.name = p.name + string('A'+rand.Intn(26))
+// client plays at a table of the server at host. With a token, it
+// rejoins the table under the name it had, after losing the connection.
+// A spectator only watches, and has no name.
+func client(host, name string, table int, token string, watch bool) {
+	p := &Player{name: name, trigger: make(chan bool)}
+	if watch {
+		p.name = ""
+	} else if p.name == "" {
+		rand.Seed(time.Now().Unix())
+		for i := 0; i < 3; i++ {
+			p.name = p.name + string('A'+rand.Intn(26))
+		}
 	}
 	host = "http://" + host + "/"
-	send := func(u string) string {
-		resp, err := http.Get(u)
+	// send makes a request, with v as its JSON body if not nil, and
+	// returns the reply.
+	send := func(u string, v interface{}) reply {
+		var resp *http.Response
+		var err error
+		if v == nil {
+			resp, err = http.Get(u)
+		} else {
+			var b []byte
+			if b, err = json.Marshal(v); err != nil {
+				log.Fatal(err)
+			}
+			resp, err = http.Post(u, "application/json", bytes.NewReader(b))
+		}
 		if err != nil {
 			log.Fatal(err)
 		}
 		defer resp.Body.Close()
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
+		var rep reply
+		if err := json.NewDecoder(resp.Body).Decode(&rep); err != nil {
 			log.Fatal(err)
 		}
-		return string(body)
+		return rep
 	}
-	next := func() []string {
-		for {
-			body := send(host + "poll?id=" + p.name)
-			if body == "wait" {
-				time.Sleep(200 * time.Millisecond)
+	var rep reply
+	if watch {
+		rep = send(host+"watch", hello{Version: protocolVersion, Table: table})
+	} else if token != "" {
+		if name == "" {
+			log.Fatal("need a name to rejoin")
+		}
+		rep = send(host+"reconnect", hello{Version: protocolVersion, Name: p.name, Table: table, Token: token})
+	} else {
+		rep = send(host+"reg", hello{Version: protocolVersion, Name: p.name, Table: table})
+	}
+	if rep.Error != "" {
+		log.Fatalf("registration: %v", rep.Error)
+	}
+	if rep.Version != protocolVersion {
+		log.Fatalf("registration: server speaks protocol version %v, want %v", rep.Version, protocolVersion)
+	}
+	tellToken := func(token string) {
+		fmt.Printf("To rejoin: -name %v -table %v -token %v\n", p.name, rep.Table, token)
+	}
+	seat := fmt.Sprintf("table=%v&id=%v&token=", rep.Table, url.QueryEscape(p.name))
+	if watch {
+		fmt.Printf("Watching table %v\n", rep.Table)
+		seat = fmt.Sprintf("table=%v&token=", rep.Table)
+	} else {
+		fmt.Printf("Joined table %v\n", rep.Table)
+		tellToken(rep.Token)
+		fmt.Printf("Start a line with %v to chat.\n", chatPrefix)
+	}
+	// id names and authenticates us in requests. It changes with the
+	// session token after each game. The console reads it to chat.
+	var idMu sync.Mutex
+	id := seat + rep.Token
+	getID := func() string {
+		idMu.Lock()
+		defer idMu.Unlock()
+		return id
+	}
+	msgs := make(chan message)
+	// Chat has no place in the game, so it skips the queue.
+	chats := make(chan message, 16)
+	go func() {
+		resp, err := http.Get(host + "events?" + id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if resp.Header.Get("Content-Type") != "text/event-stream" {
+			body, _ := ioutil.ReadAll(resp.Body)
+			log.Fatalf("events: %s", body)
+		}
+		sc := bufio.NewScanner(resp.Body)
+		sc.Buffer(nil, 1<<20)
+		for sc.Scan() {
+			line := sc.Text()
+			if !strings.HasPrefix(line, "data:") {
 				continue
 			}
-			v := strings.Split(body, ";")
-			if len(v) == 0 {
-				log.Printf("malformed response: %q", body)
+			var m message
+			if err := json.Unmarshal([]byte(line[len("data:"):]), &m); err != nil {
+				log.Fatal("events: ", err)
+			}
+			if m.Type == "chat" {
+				chats <- m
 				continue
 			}
-			return v
+			msgs <- m
 		}
-		panic("unreachable")
-	}
-	if err := send(host + "reg?name=" + p.name); err != p.name {
-		log.Fatalf("registration: " + err)
+		log.Fatal("event stream ended: ", sc.Err())
+	}()
+	// held is a message put back to be read again.
+	var held *message
+	next := func() message {
+		if held != nil {
+			m := *held
+			held = nil
+			return m
+		}
+		return <-msgs
 	}
 
 	game := &Game{
@@ -56,41 +140,68 @@ func client(host string) {
 			if p != other {
 				return
 			}
-			v := next()
-			if v[0] != "go" {
-				log.Fatalf("want 'go', got %q", v[0])
+			if cmd.s == "quit" {
+				// Leave without ending the game for the others.
+				return
+			}
+			if m := next(); m.Type != "go" {
+				log.Fatalf("want 'go', got %q", m.Type)
+			}
+			if rep := send(host+"cmd?"+getID(), encodeCommand(*cmd)); rep.Error != "" {
+				log.Fatalf("%v: %v", cmd.s, rep.Error)
 			}
-			u := host + "cmd?id=" + p.name + "&s=" + cmd.s
-			if cmd.c != nil {
-				u += "&c=" + string(cmd.c.key)
+			if m := next(); m.Type == "error" {
+				log.Fatalf("server refused %v: %v", cmd.s, m.Error)
+			} else {
+				held = &m
 			}
-			send(u)
-			confirm := game.fetch()
-			if confirm[0] != cmd.s {
-				log.Fatalf("want %q, got %q", cmd.s, confirm[0])
+			m := next()
+			if m.Type != "cmd" || m.Cmd == nil {
+				log.Fatalf("want %q, got %q", cmd.s, m.Type)
 			}
-			if len(confirm) == 2 && confirm[1] != string(cmd.c.key) {
-				log.Fatalf("want %q, got %q", string(cmd.c.key), confirm[1])
+			if confirm := m.Cmd; confirm.Cmd != cmd.s || confirm.Card != encodeCommand(*cmd).Card {
+				log.Fatalf("want %q %q, got %q %q", cmd.s, encodeCommand(*cmd).Card, confirm.Cmd, confirm.Card)
 			}
 		}, GetDiscard: func(game *Game, p *Player) string {
-			return send(fmt.Sprintf("%vdiscard?n=%v", host, p.n))
+			rep := send(fmt.Sprintf("%vdiscard?%v&n=%v", host, getID(), p.n), nil)
+			if rep.Error != "" {
+				log.Fatalf("discard: %v", rep.Error)
+			}
+			return rep.Card
+		},
+		fetch: next,
+		sendChat: func(game *Game, p *Player, text string) error {
+			if watch {
+				return errors.New("spectators cannot chat")
+			}
+			if rep := send(host+"chat?"+getID(), chatLine{text}); rep.Error != "" {
+				return errors.New(rep.Error)
+			}
+			return nil
 		},
-		fetch: func() []string { return next()[1:] },
 	}
+	go func() {
+		for m := range chats {
+			game.Report(ChatEvent{m.From, m.Text})
+		}
+	}()
+	// We never see our deck in order, so any shuffle will do.
+	game.Seed(0)
+	p.fun = consoleGamer{game.Subscribe()}
 
 	sharedTrigger := make(chan bool)
 	go func() {
 		for {
 			<-sharedTrigger
-			w := game.fetch()
-			switch len(w) {
-			default:
-				log.Fatal("bad command ", w)
-			case 1:
-				game.ch <- Command{s: w[0]}
-			case 2:
-				game.ch <- Command{s: w[0], c: game.keyToCard(w[1][0])}
+			m := game.fetch()
+			if m.Type != "cmd" || m.Cmd == nil {
+				log.Fatalf("want command, got %q", m.Type)
+			}
+			cmd, err := decodeCommand(m.Cmd)
+			if err != nil {
+				log.Fatal("bad command: ", err)
 			}
+			game.ch <- cmd
 		}
 	}()
 	go p.fun.start(game, p)
@@ -100,57 +211,76 @@ func client(host string) {
 		game.players = nil
 		p.hand = nil
 		p.discard = nil
-		heading := ""
-		pn := 0
-		var v []string
+		p.turns = 0
+		var m message
 		for {
-			v = strings.Split(next()[0], "\n")
-			if v[0] == "new" {
+			m = next()
+			if m.Type == "new" || m.Type == "resume" {
 				break
 			}
-		}
-		for _, line := range v[1:] {
-			if len(line) == 0 {
-				continue
-			}
-			re := regexp.MustCompile("= (.*) =")
-			if h := re.FindStringSubmatch(line); h != nil {
-				heading = h[1]
-				continue
+			if m.Type == "token" {
+				idMu.Lock()
+				id = seat + m.Token
+				idMu.Unlock()
+				tellToken(m.Token)
 			}
-			switch heading {
-			case "Players":
-				var x *Player
-				if line == p.name {
-					x = p
-				} else {
-					x = &Player{name: line, trigger: sharedTrigger}
-					x.hand = make(Pile, 5, 5)
-				}
-				game.players = append(game.players, x)
-				x.n = pn
-				x.InitDeck()
-				x.deck = make(Pile, len(x.manifest)-5, len(x.manifest))
-				pn++
-			case "Hand":
-				for _, c := range []byte(line) {
-					p.hand = append(p.hand, game.keyToCard(c))
+			if m.Type == "go" {
+				// We opened the table, so we say when to start.
+				held = &m
+				if game.getCommand(p, nil).s == "quit" {
+					return
 				}
-			case "Kingdom":
-				w := strings.Split(line, ",")
-				if len(w) != 3 {
-					log.Printf("malformed line: %q", line)
-					break
+			}
+		}
+		if m.Type == "resume" {
+			err := game.restore(m.View, func(name string) *Player {
+				if name == p.name {
+					return p
 				}
-				c := GetCard(w[0])
-				game.suplist = append(game.suplist, c)
-				c.supply = PanickyAtoi(w[1])
-				c.key = byte(PanickyAtoi(w[2]))
-			default:
-				log.Printf("unknown heading: %q", heading)
+				return &Player{name: name, trigger: sharedTrigger}
+			})
+			if err != nil {
+				log.Fatal("resume: ", err)
+			}
+			game.redo = decodeRedo(m.Redo)
+			game.dump()
+			if game.resume().quit {
+				return
+			}
+			continue
+		}
+		for n, name := range m.Players {
+			var x *Player
+			if name == p.name {
+				x = p
+			} else {
+				x = &Player{name: name, trigger: sharedTrigger}
+				x.hand = make(Pile, 5, 5)
+			}
+			game.players = append(game.players, x)
+			x.n = n
+			x.InitDeck()
+			x.deck = make(Pile, len(x.manifest)-5, len(x.manifest))
+		}
+		for _, sp := range m.Supply {
+			c, ok := CardDict[sp.Card]
+			if !ok || len(sp.Key) != 1 {
+				log.Printf("malformed pile: %+v", sp)
+				continue
 			}
+			game.suplist = append(game.suplist, c)
+			game.supply[c] = sp.Count
+			game.keys[c] = sp.Key[0]
+		}
+		hand, err := namesPile(m.Hand)
+		if err != nil {
+			log.Fatal(err)
 		}
+		p.hand = hand
+		game.redo = decodeRedo(m.Redo)
 		game.dump()
-		game.mainloop()
+		if game.mainloop().quit {
+			return
+		}
 	}
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// config holds the settings of the server and of the table it hosts for
+// its own players, from a config file and flags.
+//
+// A config file is JSON, as in
+//
+//	{
+//		"Addr": ":8080",
+//		"Seats": ["Ben", "AI=montecarlo:500ms"],
+//		"Preset": "Random",
+//		"Kingdom": {"Sets": ["Base", "Seaside"], "Village": true, "MaxAttacks": 1},
+//		"Games": 3
+//	}
+//
+// Fields left out keep their defaults.
+type config struct {
+	Addr    string       // Address on which to listen for remote players.
+	Seats   []string     // Local seats; see seat.
+	Preset  string       // Preset of each game, "Random" for a random kingdom, or "" for a random preset.
+	Kingdom kingdomRules // Rules for random kingdoms.
+	Games   int          // Games to play before exiting, or 0 for no end.
+}
+
+var defaultConfig = config{
+	Addr:  ":8080",
+	Seats: []string{"Ben", "AI=Province, Gold, Silver"},
+}
+
+// loadConfig reads a config file over cfg.
+func loadConfig(name string, cfg *config) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("%v: %v", name, err)
+	}
+	return nil
+}
+
+// seatList is a flag that may be given once per seat.
+type seatList []string
+
+func (v *seatList) String() string { return strings.Join(*v, " ") }
+
+func (v *seatList) Set(s string) error {
+	*v = append(*v, s)
+	return nil
+}
+
+// seat returns the player described by spec: a name, for a seat played
+// at the console, or name=bot for a bot (see newBot), as in
+// "AI=heuristic:Province,Gold". A bot is seeded with seed.
+func seat(game *Game, spec string, seed int64) (*Player, error) {
+	v := strings.SplitN(spec, "=", 2)
+	name := strings.TrimSpace(v[0])
+	if name == "" {
+		return nil, fmt.Errorf("seat %q has no name", spec)
+	}
+	p := &Player{name: name}
+	if len(v) == 1 {
+		p.fun = consoleGamer{game.Subscribe()}
+		return p, nil
+	}
+	fun, err := newBot(strings.TrimSpace(v[1]), seed)
+	if err != nil {
+		return nil, fmt.Errorf("seat %v: %v", name, err)
+	}
+	p.fun = fun
+	return p, nil
+}
+
+// players returns the local players of cfg. Bots are seeded from the
+// game's seed, but not from its rng, which would change the shuffles.
+func (cfg *config) players(game *Game) ([]*Player, error) {
+	var local []*Player
+	console := false
+	rng := rand.New(rand.NewSource(game.seed))
+	for _, spec := range cfg.Seats {
+		p, err := seat(game, spec, rng.Int63())
+		if err != nil {
+			return nil, err
+		}
+		for _, x := range local {
+			if x.name == p.name {
+				return nil, errors.New("two seats named " + p.name)
+			}
+		}
+		if _, ok := p.fun.(consoleGamer); ok {
+			if console {
+				return nil, errors.New("only one seat can be played at the console")
+			}
+			console = true
+		}
+		local = append(local, p)
+	}
+	return local, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "gominion.json")
+	if err := os.WriteFile(name, []byte(`{"Seats": ["Ann", "Bot=heuristic:Province,Gold"], "Games": 2}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := defaultConfig
+	if err := loadConfig(name, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != ":8080" || cfg.Games != 2 {
+		t.Errorf("want defaults kept and 2 games, got %+v", cfg)
+	}
+	players, err := cfg.players(newGame())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(players) != 2 || players[0].name != "Ann" || players[1].name != "Bot" {
+		t.Fatalf("want Ann and Bot, got %v", players)
+	}
+	if _, ok := players[0].fun.(consoleGamer); !ok {
+		t.Error("want Ann at the console")
+	}
+	if _, ok := players[1].fun.(Heuristic); !ok {
+		t.Errorf("want a heuristic bot, got %T", players[1].fun)
+	}
+	for _, seats := range [][]string{
+		{"Ann", "Ben"},
+		{"Ann", "Ann=Province"},
+		{"=Province"},
+		{"Bot=montecarlo:never"},
+	} {
+		cfg.Seats = seats
+		if _, err := cfg.players(newGame()); err == nil {
+			t.Errorf("%q: want error", seats)
+		}
+	}
+	if err := os.WriteFile(name, []byte(`{"Port": 80}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(name, &cfg); err == nil {
+		t.Error("want error for unknown setting")
+	}
+}
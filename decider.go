@@ -0,0 +1,153 @@
+package main
+
+// Kinds of decision.
+const (
+	decTop    = iota // Play, buy or move to the next phase.
+	decSplit         // Pick cards from a pile, e.g. from the hand.
+	decSupply        // Pick a card from the supply.
+	decBool          // Yes or no.
+	decChoose        // Choose among options.
+)
+
+// A Decision describes what the engine is asking a player. The engine
+// sets game.decision before asking.
+type Decision struct {
+	kind     int
+	card     *Card // Card being played, or nil.
+	prompt   string
+	options  Pile     // For decSplit and decSupply, the cards that may still be picked.
+	n        int      // Cards to pick, or options to choose.
+	exact    bool     // For decSplit, whether fewer than n may not be picked.
+	optional bool     // For decSupply, whether nothing may be picked.
+	names    []string // For decChoose, the options.
+	shown    Pile     // For decBool, the cards asked about, if any.
+}
+
+// ask describes the decision about to be asked for.
+func (game *Game) ask(d *Decision) {
+	if frame := game.StackTop(); frame != nil {
+		d.card = frame.card
+	}
+	game.decision = d
+}
+
+// A Decider makes decisions for a bot. Each method is told who decides
+// and what is being decided, and must give a legal answer.
+type Decider interface {
+	// Turn returns a play, buy or next Command.
+	Turn(game *Game, p *Player, d *Decision) Command
+	// Split returns the cards of d.options to pick.
+	Split(game *Game, p *Player, d *Decision) Pile
+	// PickCard returns one of d.options, or nil if d.optional.
+	PickCard(game *Game, p *Player, d *Decision) *Card
+	Bool(game *Game, p *Player, d *Decision) bool
+	// Choose returns d.n different indexes into d.names.
+	Choose(game *Game, p *Player, d *Decision) []int
+}
+
+// DefaultDecider makes safe, simple decisions: it plays treasures but
+// never actions, buys nothing, picks as few cards as it may, says no, and
+// gains the most expensive card it can. Bots embed it and override what
+// they care about.
+type DefaultDecider struct{}
+
+func (DefaultDecider) Turn(game *Game, p *Player, d *Decision) Command {
+	if c := handTreasure(game, p); c != nil {
+		return Command{s: "play", c: c}
+	}
+	return Command{s: "next"}
+}
+
+// handTreasure returns a treasure in p's hand that may be played now, or
+// nil.
+func handTreasure(game *Game, p *Player) *Card {
+	if game.phase != phBuy || game.bCount > 0 {
+		return nil
+	}
+	for k := len(p.hand) - 1; k >= 0; k-- {
+		if p.hand[k].IsTreasure() {
+			return p.hand[k]
+		}
+	}
+	return nil
+}
+
+// Split picks the first cards it must. Whether picked cards are kept,
+// discarded or trashed depends on d.card, so it cannot do better.
+func (DefaultDecider) Split(game *Game, p *Player, d *Decision) Pile {
+	if !d.exact {
+		return nil
+	}
+	return d.options[:d.n]
+}
+
+func (DefaultDecider) PickCard(game *Game, p *Player, d *Decision) *Card {
+	var best *Card
+	for _, c := range d.options {
+		if best == nil || game.Cost(c) > game.Cost(best) {
+			best = c
+		}
+	}
+	return best
+}
+
+func (DefaultDecider) Bool(game *Game, p *Player, d *Decision) bool { return false }
+
+func (DefaultDecider) Choose(game *Game, p *Player, d *Decision) []int {
+	var v []int
+	for i := 0; i < d.n; i++ {
+		v = append(v, i)
+	}
+	return v
+}
+
+// playDecider plays for p by asking d. It is the start method of bots
+// that are Deciders.
+func playDecider(game *Game, p *Player, d Decider) { playDeciderUntil(game, p, d, nil) }
+
+// playDeciderUntil is playDecider, except it returns once quit is closed.
+func playDeciderUntil(game *Game, p *Player, d Decider, quit <-chan bool) {
+	var last *Decision
+	var queue []Command // Commands still to send for the last decision.
+	for {
+		select {
+		case <-p.trigger:
+		case <-quit:
+			return
+		}
+		if game.phase == phSetup {
+			game.ch <- Command{s: "start"}
+			continue
+		}
+		dec := game.decision
+		if dec != last {
+			last, queue = dec, nil
+			switch dec.kind {
+			case decTop:
+				queue = append(queue, d.Turn(game, p, dec))
+			case decSplit:
+				for _, c := range d.Split(game, p, dec) {
+					queue = append(queue, Command{s: "pick", c: c})
+				}
+				queue = append(queue, Command{s: "done"})
+			case decSupply:
+				queue = append(queue, Command{s: "pick", c: d.PickCard(game, p, dec)})
+			case decBool:
+				if d.Bool(game, p, dec) {
+					queue = append(queue, Command{s: "yes"})
+				} else {
+					queue = append(queue, Command{s: "done"})
+				}
+			case decChoose:
+				for _, i := range d.Choose(game, p, dec) {
+					queue = append(queue, Command{s: string(rune('1' + i))})
+				}
+			}
+		}
+		if len(queue) == 0 {
+			panic(p.name + ": no answer to " + dec.prompt)
+		}
+		game.ch <- queue[0]
+		queue = queue[1:]
+	}
+}
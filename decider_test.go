@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestDefaultDecider(t *testing.T) {
+	players := Setup(t, `
+= Alice =
+hand:Militia
+= Bob =
+hand:Gold,Estate,Curse,Copper,Silver
+`)
+	game := newGame()
+	game.players = players
+	bob := players[1]
+	bob.fun = SimpleBuyer{}
+	go bob.fun.start(game, bob)
+	game.NewGame()
+	game.StartTurn(0)
+	go game.resume()
+	<-players[0].trigger
+	game.ch <- Command{s: "play", c: GetCard("Militia")}
+	<-players[0].trigger
+	CheckPiles(t, players, `
+= Alice =
+played:Militia
+= Bob =
+hand:Gold,Estate,Curse
+discard:Copper,Silver
+`)
+}
@@ -0,0 +1,164 @@
+package main
+
+import "fmt"
+
+// Events describe what happens in a game, for listeners such as the
+// console, loggers and stats collectors. Unlike commands, they flow one
+// way: the game never waits on a listener.
+//
+// Each event carries what a listener needs to show it, since by the time
+// it is read the game may have moved on. Players are given by number.
+type Event interface {
+	event()
+}
+
+// TextEvent describes what happened in words; see Game.Printf.
+type TextEvent struct {
+	s string
+}
+
+// DrawEvent: player n drew cards. Cards unknown to a client are nil.
+type DrawEvent struct {
+	n     int
+	cards Pile
+}
+
+type GainEvent struct {
+	n    int
+	card *Card
+}
+
+type TrashEvent struct {
+	n    int
+	card *Card
+}
+
+// DiscardEvent: player n discarded count cards, ending with top. If deck
+// is set, the whole deck was discarded.
+type DiscardEvent struct {
+	n     int
+	count int
+	top   string
+	deck  bool
+}
+
+// ChatEvent: someone said something; see Game.chat.
+type ChatEvent struct {
+	from, text string
+}
+
+type RevealEvent struct {
+	n     int
+	cards Pile
+}
+
+// PhaseEvent: the current player n entered a phase.
+type PhaseEvent struct {
+	n     int
+	phase int
+}
+
+type PlayEvent struct {
+	n    int
+	card *Card
+}
+
+type BuyEvent struct {
+	n    int
+	card *Card
+}
+
+type TurnEvent struct {
+	n    int
+	turn int
+}
+
+// RefusedEvent: a command of player n was refused, for a reason only
+// that player is shown.
+type RefusedEvent struct {
+	n   int
+	msg string
+}
+
+// EndEvent: the game is over.
+type EndEvent struct {
+	result *Result
+}
+
+func (TextEvent) event()    {}
+func (ChatEvent) event()    {}
+func (DrawEvent) event()    {}
+func (GainEvent) event()    {}
+func (TrashEvent) event()   {}
+func (DiscardEvent) event() {}
+func (RevealEvent) event()  {}
+func (PhaseEvent) event()   {}
+func (PlayEvent) event()    {}
+func (BuyEvent) event()     {}
+func (TurnEvent) event()    {}
+func (RefusedEvent) event() {}
+func (EndEvent) event()     {}
+
+// Events a listener has yet to read before it starts missing them.
+const eventBuffer = 256
+
+// Subscribe returns a channel on which the events of the game arrive.
+// A listener that falls behind misses events rather than holding up the
+// game.
+func (game *Game) Subscribe() <-chan Event {
+	ch := make(chan Event, eventBuffer)
+	game.subMu.Lock()
+	game.subs = append(game.subs, ch)
+	game.subMu.Unlock()
+	return ch
+}
+
+// Unsubscribe stops events arriving on ch, and closes it.
+func (game *Game) Unsubscribe(ch <-chan Event) {
+	game.subMu.Lock()
+	defer game.subMu.Unlock()
+	for i, x := range game.subs {
+		if x == ch {
+			game.subs = append(game.subs[:i], game.subs[i+1:]...)
+			close(x)
+			return
+		}
+	}
+}
+
+func (game *Game) listened() bool {
+	game.subMu.Lock()
+	defer game.subMu.Unlock()
+	return len(game.subs) > 0
+}
+
+// logEvents prints the text of the events of a game with no one at the
+// console.
+func logEvents(events <-chan Event) {
+	for ev := range events {
+		switch ev := ev.(type) {
+		case TextEvent:
+			fmt.Print(ev.s)
+		case ChatEvent:
+			fmt.Printf("<%v> %v\n", ev.from, ev.text)
+		case EndEvent:
+			fmt.Printf("Game over\n%v", ev.result)
+		}
+	}
+}
+
+// Report sends ev to every listener. Commands that are being redone after
+// an undo have already been reported.
+func (game *Game) Report(ev Event) {
+	if game.quiet {
+		return
+	}
+	game.subMu.Lock()
+	defer game.subMu.Unlock()
+	for _, ch := range game.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
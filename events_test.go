@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestEvents(t *testing.T) {
+	players := Setup(t, `
+= Alice =
+deck:Gold,Silver,Copper
+`)
+	game := &Game{players: players, isServer: true}
+	game.NewGame()
+	game.StartTurn(0)
+	events := game.Subscribe()
+	game.supply = map[*Card]int{GetCard("Estate"): 8}
+	game.draw(players[0], 2)
+	game.panickyGain(players[0], GetCard("Estate"))
+	if ev, ok := (<-events).(DrawEvent); !ok || ComparePiles(ev.cards, ParsePile("Gold,Silver")) != "" {
+		t.Errorf("want draw of Gold,Silver, got %v", ev)
+	}
+	if ev, ok := (<-events).(GainEvent); !ok || ev.card != GetCard("Estate") {
+		t.Errorf("want gain of Estate, got %v", ev)
+	}
+	game.Unsubscribe(events)
+	game.Printf("unheard\n")
+	if _, ok := <-events; ok {
+		t.Error("event after Unsubscribe")
+	}
+}
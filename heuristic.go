@@ -0,0 +1,571 @@
+package main
+
+import "sort"
+
+// Heuristic is a bot that buys by buy rules, as SimpleBuyer does, and
+// plays its actions by rules of thumb: villages and other cards that give
+// back the action first, then, while actions remain, cards that draw,
+// then whichever card is worth most. It knows enough of every card in
+// the base game, Intrigue and Seaside to decide what they ask.
+type Heuristic struct {
+	SimpleBuyer
+	*heuristicState
+}
+
+// heuristicState is what a Heuristic remembers between decisions.
+type heuristicState struct {
+	revealed map[*Card]bool // Reactions revealed to the current attack.
+	frame    *Frame         // The card being played when last picking cards.
+	picks    int            // How often cards were picked for it.
+}
+
+// newHeuristic returns a Heuristic following buy rules given as for
+// newSimpleBuyer.
+func newHeuristic(spec string) (Heuristic, error) {
+	sb, err := newSimpleBuyer(spec)
+	return Heuristic{sb, &heuristicState{revealed: make(map[*Card]bool)}}, err
+}
+
+func (this Heuristic) start(game *Game, p *Player) { playDecider(game, p, this) }
+
+func (this Heuristic) Turn(game *Game, p *Player, d *Decision) Command {
+	if game.phase != phAction {
+		return this.SimpleBuyer.Turn(game, p, d)
+	}
+	var best *Card
+	bestV := 0.0
+	for _, c := range p.hand {
+		if !c.IsAction() {
+			continue
+		}
+		v := playValue(game, p, c)
+		if v <= 0 {
+			continue
+		}
+		if !isTerminal(game, c) {
+			v += 100
+		} else if game.a > 1 && c.cards > 0 {
+			// Draw first, in case it finds more to play.
+			v += 50
+		}
+		if v > bestV {
+			best, bestV = c, v
+		}
+	}
+	if best == nil {
+		return Command{s: "next"}
+	}
+	return Command{s: "play", c: best}
+}
+
+// isTerminal reports whether playing c uses up an action.
+func isTerminal(game *Game, c *Card) bool {
+	switch c.name {
+	case "Nobles", "Pawn":
+		return false
+	case "Conspirator":
+		return game.aCount < 2
+	}
+	return c.actions == 0
+}
+
+// playValue is roughly what playing c from p's hand is worth, in coins.
+// It is not positive if c is better left unplayed.
+func playValue(game *Game, p *Player, c *Card) float64 {
+	density := drawDensity(p)
+	v := float64(c.coin) + float64(c.cards)*density + float64(c.buys)/2
+	if c.IsAttack() {
+		v++
+	}
+	others := func(cond func(*Card) bool) int {
+		n, self := 0, false
+		for _, x := range p.hand {
+			if x == c && !self {
+				self = true
+				continue
+			}
+			if cond(x) {
+				n++
+			}
+		}
+		return n
+	}
+	switch c.name {
+	case "Throne Room":
+		best := 0.0
+		for _, x := range p.hand {
+			if x.IsAction() && x != c {
+				if t := playValue(game, p, x); t > best {
+					best = t
+				}
+			}
+		}
+		return 2 * best
+	case "Chapel":
+		return float64(len(junk(game, p, p.hand, 4, true)))
+	case "Trading Post":
+		if len(junk(game, p, p.hand, 2, true)) < 2 {
+			return 0
+		}
+		return 2
+	case "Moneylender":
+		if others(func(x *Card) bool { return x.name == "Copper" }) == 0 {
+			return 0
+		}
+		return 2
+	case "Mine":
+		if others((*Card).IsTreasure) == 0 {
+			return 0
+		}
+		return 1.5
+	case "Remodel", "Salvager":
+		if others(func(x *Card) bool { return trashWorth(game, x) < 0 || c.name == "Remodel" && remodelGold(game, x) }) == 0 {
+			return 0
+		}
+		return 1.5 + v
+	case "Baron":
+		if others(func(x *Card) bool { return x.name == "Estate" }) > 0 {
+			return 4.5
+		}
+	case "Coppersmith":
+		return float64(others(func(x *Card) bool { return x.name == "Copper" }))
+	case "Treasure Map":
+		if others(func(x *Card) bool { return x == c }) == 0 {
+			return 0
+		}
+		return 10
+	case "Tactician":
+		if others(func(*Card) bool { return true }) == 0 || handCoins(p) > 3 {
+			return 0
+		}
+		return 4
+	case "Secret Chamber":
+		return float64(others(func(x *Card) bool { return !x.IsTreasure() }))
+	case "Library":
+		if n := 7 - len(p.hand) + 1; n > 0 {
+			return float64(n) * density
+		}
+		return 0
+	case "Nobles":
+		return 3 * density
+	case "Adventurer":
+		for _, pile := range []Pile{p.deck, p.discard} {
+			for _, x := range pile {
+				if x.IsTreasure() {
+					return 3
+				}
+			}
+		}
+		return 0
+	case "Explorer", "Steward", "Tribute", "Minion":
+		return v + 2
+	case "Feast", "Workshop", "Ironworks", "Bridge", "Pawn", "Smugglers":
+		return v + 1.5
+	case "Pirate Ship":
+		if n, ok := game.data["Pirate Ship/"+p.name].(int); ok && n > 1 {
+			return float64(n)
+		}
+	case "Witch", "Sea Hag", "Torturer":
+		v += 2
+	}
+	if v <= 0 {
+		// Nothing lost by playing it.
+		v = 0.5
+	}
+	return v
+}
+
+// drawDensity is the average coin of the cards p would draw next.
+func drawDensity(p *Player) float64 {
+	pile := p.deck
+	if len(pile) == 0 {
+		pile = p.discard
+	}
+	if len(pile) == 0 {
+		return 0
+	}
+	n := 0
+	for _, c := range pile {
+		if c != nil && c.IsTreasure() {
+			n += c.coin
+		}
+	}
+	return float64(n) / float64(len(pile))
+}
+
+// handCoins is the coin of the treasures in p's hand.
+func handCoins(p *Player) int {
+	n := 0
+	for _, c := range p.hand {
+		if c.IsTreasure() {
+			n += c.coin
+		}
+	}
+	return n
+}
+
+// worth is how much a card is worth keeping, in rough coins.
+func worth(c *Card) int {
+	switch {
+	case c == nil:
+		return 0
+	case c.HasKind(kCurse):
+		return -2
+	case c.IsVictory() && !c.IsTreasure() && !c.IsAction():
+		return -1
+	case c.name == "Copper":
+		return 1
+	}
+	return c.cost
+}
+
+// trashWorth is how much a card is worth not trashing.
+func trashWorth(game *Game, c *Card) int {
+	switch {
+	case c == nil:
+		return 0
+	case c.HasKind(kCurse):
+		return -2
+	case c.name == "Estate" && !lateGame(game):
+		return -1
+	case c.IsVictory():
+		return 20 + c.cost
+	case c.name == "Copper":
+		return 0
+	}
+	return c.cost
+}
+
+// remodelGold reports whether c is a Gold to remodel into a Province.
+func remodelGold(game *Game, c *Card) bool {
+	return c.name == "Gold" && lateGame(game)
+}
+
+// trashWorst returns the n cards of pile least worth not trashing.
+func trashWorst(game *Game, pile Pile, n int) Pile {
+	v := append(Pile(nil), pile...)
+	sort.SliceStable(v, func(i, j int) bool { return trashWorth(game, v[i]) < trashWorth(game, v[j]) })
+	if n < len(v) {
+		v = v[:n]
+	}
+	return v
+}
+
+// worst returns the n cards of pile least worth keeping, or fewer if
+// pile is short.
+func worst(pile Pile, n int) Pile {
+	v := append(Pile(nil), pile...)
+	sort.SliceStable(v, func(i, j int) bool { return worth(v[i]) < worth(v[j]) })
+	if n < len(v) {
+		v = v[:n]
+	}
+	return v
+}
+
+// best returns the n cards of pile most worth keeping.
+func best(pile Pile, n int) Pile {
+	v := append(Pile(nil), pile...)
+	sort.SliceStable(v, func(i, j int) bool { return worth(v[i]) > worth(v[j]) })
+	if n < len(v) {
+		v = v[:n]
+	}
+	return v
+}
+
+// junk returns up to n cards of pile that p would be better off
+// without: Curses, Estates until the game is nearly over, and if coppers
+// is set, Coppers while enough money is left.
+func junk(game *Game, p *Player, pile Pile, n int, coppers bool) Pile {
+	money := 0
+	for _, c := range p.manifest {
+		if c.IsTreasure() {
+			money += c.coin
+		}
+	}
+	var v Pile
+	for _, c := range worst(pile, len(pile)) {
+		if len(v) == n {
+			break
+		}
+		switch {
+		case c.HasKind(kCurse):
+		case c.name == "Estate" && !lateGame(game):
+		case c.name == "Copper" && coppers && money > 6:
+			money--
+		default:
+			continue
+		}
+		v = append(v, c)
+	}
+	return v
+}
+
+// topVictory returns the costliest Victory card in the supply.
+func topVictory(game *Game) *Card {
+	var top *Card
+	for _, c := range game.suplist {
+		if c.IsVictory() && (top == nil || game.Cost(c) > game.Cost(top)) {
+			top = c
+		}
+	}
+	return top
+}
+
+// lateGame reports whether the game is near its end: the costliest
+// Victory pile is running low.
+func lateGame(game *Game) bool {
+	top := topVictory(game)
+	return top == nil || game.supply[top] <= 4
+}
+
+// dead reports whether c is no use in p's hand this turn.
+func dead(game *Game, c *Card) bool {
+	if c.IsAction() {
+		return game.a == 0
+	}
+	return !c.IsTreasure()
+}
+
+func (this Heuristic) Split(game *Game, p *Player, d *Decision) Pile {
+	opts := d.options
+	if d.card == nil {
+		return this.DefaultDecider.Split(game, p, d)
+	}
+	if p != game.p {
+		if !d.exact && d.card.IsAttack() {
+			// Reveal each reaction once.
+			for _, c := range opts {
+				if !this.revealed[c] {
+					this.revealed[c] = true
+					return Pile{c}
+				}
+			}
+			for c := range this.revealed {
+				delete(this.revealed, c)
+			}
+			return nil
+		}
+		switch d.card.name {
+		case "Militia", "Ghost Ship":
+			// The cards picked are kept.
+			return best(opts, d.n)
+		}
+		return worst(opts, d.n)
+	}
+	// Which pick this is, for cards that ask more than once.
+	if top := game.StackTop(); top != this.frame {
+		this.frame, this.picks = top, 0
+	}
+	pass := this.picks
+	this.picks++
+	switch d.card.name {
+	case "Cellar", "Secret Chamber":
+		var v Pile
+		for _, c := range opts {
+			if dead(game, c) {
+				v = append(v, c)
+			}
+		}
+		return v
+	case "Chapel", "Trading Post", "Steward":
+		v := junk(game, p, opts, d.n, d.card.name != "Steward")
+		if d.exact && len(v) < d.n {
+			return trashWorst(game, opts, d.n)
+		}
+		return v
+	case "Throne Room":
+		var top *Card
+		for _, c := range opts {
+			if top == nil || playValue(game, p, c) > playValue(game, p, top) {
+				top = c
+			}
+		}
+		return Pile{top}
+	case "Mine":
+		for _, name := range []string{"Silver", "Copper"} {
+			for _, c := range opts {
+				if c.name == name {
+					return Pile{c}
+				}
+			}
+		}
+	case "Remodel":
+		for _, c := range opts {
+			if remodelGold(game, c) {
+				return Pile{c}
+			}
+		}
+		return trashWorst(game, opts, 1)
+	case "Upgrade", "Salvager":
+		return trashWorst(game, opts, 1)
+	case "Masquerade":
+		// Pass a card, then trash one.
+		if pass%2 == 1 {
+			return trashWorst(game, opts, 1)
+		}
+	case "Lookout":
+		// Trash a card, discard one, and put the last back.
+		if pass%3 == 0 {
+			return trashWorst(game, opts, 1)
+		}
+	case "Courtyard", "Haven":
+		for _, c := range opts {
+			if c.IsAction() && game.a == 0 {
+				return Pile{c}
+			}
+		}
+		return worst(opts, 1)
+	case "Thief", "Pirate Ship", "Navigator":
+		// Take the best loot, or put the best card on top.
+		return best(opts, d.n)
+	case "Smugglers":
+		if c := this.gainPick(game, p, opts); c != nil {
+			return Pile{c}
+		}
+	case "Explorer":
+		return opts[:d.n]
+	}
+	if d.exact {
+		return worst(opts, d.n)
+	}
+	return this.DefaultDecider.Split(game, p, d)
+}
+
+// gainPick returns the first card of opts whose buy rule holds, or else
+// the costliest that is not a Curse, nor a Victory card before the end is
+// near.
+func (this Heuristic) gainPick(game *Game, p *Player, opts Pile) *Card {
+	for _, r := range this.rules {
+		for _, c := range opts {
+			if c == r.card && r.holds(game, p) {
+				return c
+			}
+		}
+	}
+	var top *Card
+	for _, c := range opts {
+		if c.HasKind(kCurse) || c.IsVictory() && c != topVictory(game) && !lateGame(game) {
+			continue
+		}
+		if top == nil || game.Cost(c) > game.Cost(top) {
+			top = c
+		}
+	}
+	return top
+}
+
+func (this Heuristic) PickCard(game *Game, p *Player, d *Decision) *Card {
+	name := ""
+	if d.card != nil {
+		name = d.card.name
+	}
+	switch name {
+	case "Wishing Well":
+		// Name the commonest card left to draw.
+		count := make(map[*Card]int)
+		var top *Card
+		for _, c := range p.deck {
+			count[c]++
+			if top == nil || count[c] > count[top] {
+				top = c
+			}
+		}
+		for _, c := range d.options {
+			if c == top {
+				return c
+			}
+		}
+	case "Embargo":
+		if c := topVictory(game); c != nil && game.supply[c] > 0 {
+			return c
+		}
+	case "Swindler":
+		// The victim gets the least use of the card.
+		v := worst(d.options, 1)
+		if len(v) > 0 {
+			return v[0]
+		}
+	}
+	if c := this.gainPick(game, p, d.options); c != nil || d.optional {
+		return c
+	}
+	return this.DefaultDecider.PickCard(game, p, d)
+}
+
+func (this Heuristic) Bool(game *Game, p *Player, d *Decision) bool {
+	if d.card == nil {
+		return false
+	}
+	switch d.card.name {
+	case "Chancellor", "Treasury":
+		return true
+	case "Spy":
+		// It is someone else's card.
+		return len(d.shown) > 0 && worth(d.shown[0]) >= 3
+	case "Thief":
+		return len(d.shown) > 0 && d.shown[0].name != "Copper"
+	case "Pearl Diver":
+		return len(d.shown) > 0 && worth(d.shown[0]) >= 3
+	case "Library":
+		return game.a == 0
+	case "Navigator":
+		n := 0
+		for _, c := range d.shown {
+			if c != nil && (c.IsAction() || c.IsTreasure()) {
+				n += worth(c)
+			}
+		}
+		return n < 5
+	}
+	return false
+}
+
+func (this Heuristic) Choose(game *Game, p *Player, d *Decision) []int {
+	if d.card == nil {
+		return this.DefaultDecider.Choose(game, p, d)
+	}
+	terminals := 0
+	for _, c := range p.hand {
+		if c.IsAction() && isTerminal(game, c) {
+			terminals++
+		}
+	}
+	switch d.card.name {
+	case "Pawn":
+		if terminals > 0 && game.a == 0 {
+			return []int{0, 1} // +1 Card, +1 Action.
+		}
+		return []int{0, 3} // +1 Card, +$1.
+	case "Nobles":
+		if terminals > 0 && game.a == 0 {
+			return []int{1} // +2 Actions.
+		}
+		return []int{0}
+	case "Steward":
+		if len(junk(game, p, p.hand, 2, false)) == 2 {
+			return []int{2}
+		}
+		return []int{0}
+	case "Minion":
+		if game.c+handCoins(p) >= 5 {
+			return []int{0} // +$2.
+		}
+		return []int{1}
+	case "Torturer":
+		if game.supply[GetCard("Curse")] == 0 {
+			return []int{1}
+		}
+		return []int{0}
+	case "Native Village":
+		if mat, ok := game.data["Native Village/"+p.name].(Pile); ok && len(mat) >= 3 {
+			return []int{1}
+		}
+		return []int{0}
+	case "Pirate Ship":
+		if n, ok := game.data["Pirate Ship/"+p.name].(int); ok && n > 1 {
+			return []int{1}
+		}
+		return []int{0}
+	}
+	return this.DefaultDecider.Choose(game, p, d)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// TestHeuristicPresets plays short games between heuristic bots that buy
+// every card of each preset, so that each card is played and decided on.
+func TestHeuristicPresets(t *testing.T) {
+	for _, pr := range presets {
+		pr := pr
+		// One bot buys the cheapest cards first, the other the dearest.
+		var cheap, dear string
+		for i, c := range pr.cards {
+			cheap += c.name + ", "
+			dear += pr.cards[len(pr.cards)-1-i].name + ", "
+		}
+		money := "Province, Gold, Silver"
+		game, bots, err := newSim([]string{"heuristic:" + cheap + money, "heuristic:" + dear + money}, 100, rand.New(rand.NewSource(1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for seed := int64(1); seed <= 10; seed++ {
+			done := make(chan *Result)
+			go func() { done <- simGame(game, rotate(bots, int(seed)%2), &pr, seed) }()
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatalf("%v, seed %v: game does not end", pr.name, seed)
+			}
+		}
+	}
+}
+
+func TestHeuristic(t *testing.T) {
+	players := Setup(t, `
+= Alice =
+hand:Smithy,Copper,Village,Estate
+deck:Copper,Copper,Silver
+= Bob =
+hand:Gold,Estate,Curse,Copper,Silver
+`)
+	game := newGame()
+	game.players = players
+	game.supply = map[*Card]int{GetCard("Province"): 8}
+	game.suplist = Pile{GetCard("Province")}
+	game.p, game.phase, game.a = players[0], phAction, 1
+	h, err := newHeuristic("Province, Gold, Silver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, bob := players[0], players[1]
+	if cmd := h.Turn(game, alice, &Decision{kind: decTop}); cmd.c != GetCard("Village") {
+		t.Errorf("played %v before Village", cmd.c)
+	}
+	alice.hand = Pile{GetCard("Throne Room"), GetCard("Smithy"), GetCard("Moat")}
+	d := &Decision{kind: decSplit, card: GetCard("Throne Room"), options: alice.hand[1:], n: 1, exact: true}
+	if got := h.Split(game, alice, d); len(got) != 1 || got[0] != GetCard("Smithy") {
+		t.Errorf("Throne Room on %v", got)
+	}
+	d = &Decision{kind: decSplit, card: GetCard("Militia"), options: bob.hand, n: 3, exact: true}
+	want := Pile{GetCard("Gold"), GetCard("Silver"), GetCard("Copper")}
+	if msg := ComparePiles(h.Split(game, bob, d), want); msg != "" {
+		t.Error("Militia: ", msg)
+	}
+	adventurer := GetCard("Adventurer")
+	alice.hand, alice.deck, alice.discard = Pile{adventurer, GetCard("Copper")}, ParsePile("Estate"), ParsePile("Silver")
+	if v := playValue(game, alice, adventurer); v <= 0 {
+		t.Errorf("Adventurer with Silver in discards worth %v", v)
+	}
+	alice.discard = ParsePile("Duchy")
+	if v := playValue(game, alice, adventurer); v != 0 {
+		t.Errorf("Adventurer without treasure to find worth %v", v)
+	}
+}
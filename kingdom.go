@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// Expansions in the order they were loaded, named as in CardDB.Name.
+var cardSets []string
+
+// Cards in every supply, which are not drawn for a kingdom.
+var basicCards = []string{"Copper", "Silver", "Gold", "Estate", "Duchy", "Province", "Curse"}
+
+// Cards that give +Buy or +2 Actions only by choice or on a later turn,
+// so not in their list entries.
+var (
+	alsoBuys     = []string{"Pawn", "Tactician"}
+	alsoVillages = []string{"Nobles"}
+)
+
+func nameIn(name string, names []string) bool {
+	for _, s := range names {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Card) givesBuy() bool { return c.buys > 0 || nameIn(c.name, alsoBuys) }
+
+func (c *Card) isVillage() bool { return c.actions >= 2 || nameIn(c.name, alsoVillages) }
+
+// kingdomRules constrain the cards of a random kingdom. The zero value
+// allows any 10 kingdom cards.
+type kingdomRules struct {
+	Sets       []string // Expansions to draw from, as in "Intrigue"; all if empty.
+	PlusBuy    bool     // At least one card gives +Buy.
+	Village    bool     // At least one card gives +2 Actions.
+	MaxAttacks *int     // If non-nil, the most attacks.
+	Costs      int      // At least this many different costs.
+	Ban        []string // Cards never drawn.
+	Require    []string // Cards always drawn, from any expansion.
+}
+
+// The most kingdoms drawn in search of one that keeps the rules.
+const kingdomTries = 10000
+
+// draw returns a kingdom of 10 cards keeping the rules, named "Random".
+func (kr *kingdomRules) draw(rng *rand.Rand) (Preset, error) {
+	for _, s := range kr.Sets {
+		if !nameIn(s, cardSets) {
+			return Preset{}, fmt.Errorf("no such expansion: %q", s)
+		}
+	}
+	for _, names := range [][]string{kr.Ban, kr.Require} {
+		for _, s := range names {
+			if _, ok := CardDict[s]; !ok {
+				return Preset{}, fmt.Errorf("no such card: %q", s)
+			}
+			if nameIn(s, basicCards) {
+				return Preset{}, fmt.Errorf("%v is not a kingdom card", s)
+			}
+		}
+	}
+	var required Pile
+	for _, s := range kr.Require {
+		if nameIn(s, kr.Ban) {
+			return Preset{}, fmt.Errorf("%v is both banned and required", s)
+		}
+		if !nameIn(s, pileNames(required, false)) {
+			required = append(required, CardDict[s])
+		}
+	}
+	if len(required) > 10 {
+		return Preset{}, errors.New("more than 10 cards required")
+	}
+	var names []string
+	for name, c := range CardDict {
+		switch {
+		case nameIn(name, basicCards), nameIn(name, kr.Ban), nameIn(name, kr.Require):
+		case len(kr.Sets) > 0 && !nameIn(c.set, kr.Sets):
+		default:
+			names = append(names, name)
+		}
+	}
+	// Sort, so that the kingdom is determined by rng.
+	sort.Strings(names)
+	if len(required)+len(names) < 10 {
+		return Preset{}, errors.New("fewer than 10 cards to draw from")
+	}
+	for try := 0; try < kingdomTries; try++ {
+		cards := append(Pile{}, required...)
+		for _, i := range rng.Perm(len(names))[:10-len(required)] {
+			cards = append(cards, CardDict[names[i]])
+		}
+		if kr.keptBy(cards) {
+			sort.Slice(cards, func(i, j int) bool {
+				x, y := cards[i], cards[j]
+				return x.cost < y.cost || x.cost == y.cost && x.name < y.name
+			})
+			return Preset{name: "Random", cards: cards}, nil
+		}
+	}
+	return Preset{}, errors.New("no kingdom keeps the rules")
+}
+
+// keptBy says whether the kingdom cards keep the rules, other than those
+// about which cards to draw from.
+func (kr *kingdomRules) keptBy(cards Pile) bool {
+	buy, village, attacks := false, false, 0
+	costs := make(map[int]bool)
+	for _, c := range cards {
+		buy = buy || c.givesBuy()
+		village = village || c.isVillage()
+		if c.IsAttack() {
+			attacks++
+		}
+		costs[c.cost] = true
+	}
+	switch {
+	case kr.PlusBuy && !buy, kr.Village && !village:
+		return false
+	case kr.MaxAttacks != nil && attacks > *kr.MaxAttacks:
+		return false
+	}
+	return len(costs) >= kr.Costs
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestKingdom(t *testing.T) {
+	one := 1
+	kr := kingdomRules{
+		Sets:       []string{"Intrigue"},
+		PlusBuy:    true,
+		Village:    true,
+		MaxAttacks: &one,
+		Costs:      4,
+		Ban:        []string{"Pawn"},
+		Require:    []string{"Witch"},
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		pr, err := kr.draw(rng)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := make(map[*Card]bool)
+		witch := false
+		for _, c := range pr.cards {
+			if seen[c] {
+				t.Errorf("%v drawn twice", c.name)
+			}
+			seen[c] = true
+			switch {
+			case c.name == "Witch":
+				witch = true
+			case c.set != "Intrigue":
+				t.Errorf("%v is from %v", c.name, c.set)
+			case c.IsAttack():
+				t.Errorf("second attack %v", c.name)
+			case c.name == "Pawn":
+				t.Error("banned Pawn drawn")
+			}
+		}
+		if len(pr.cards) != 10 || !witch || !kr.keptBy(pr.cards) {
+			t.Errorf("kingdom breaks the rules: %v", pileNames(pr.cards, false))
+		}
+	}
+	for _, bad := range []kingdomRules{
+		{Sets: []string{"Prosperity"}},
+		{Ban: []string{"Witch"}, Require: []string{"Witch"}},
+		{Require: []string{"Copper"}},
+		{Sets: []string{"Seaside"}, MaxAttacks: new(int), Require: []string{"Witch"}},
+	} {
+		if _, err := bad.draw(rng); err == nil {
+			t.Errorf("%+v: want error", bad)
+		}
+	}
+}
@@ -2,17 +2,18 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"math/rand"
-	"net/http"
 	"os"
 	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -21,15 +22,21 @@ type Kind struct {
 }
 
 type Card struct {
-	key    byte
-	name   string
-	cost   int
-	kind   []*Kind
-	coin   int
-	vp     func(*Game) int
-	supply int
-	act    []func(*Game)
-	react  func(*Game, *Player)
+	name  string
+	cost  int
+	kind  []*Kind
+	coin  int
+	vp    func(*Game) int
+	act   []func(*Game)
+	react func(*Game, *Player)
+
+	// Effect at the start of the next turn, given the cards set aside.
+	duration func(*Game, Pile)
+
+	// +Cards, +Actions and +Buys, not counting effects in code.
+	cards, actions, buys int
+
+	set string // Expansion the card came from.
 }
 
 func PanickyAtoi(s string) int {
@@ -56,12 +63,13 @@ var (
 	CardDict = make(map[string]*Card)
 )
 
-var kTreasure, kVictory, kCurse, kAction, kReaction *Kind
+var kTreasure, kVictory, kCurse, kAction, kAttack, kReaction *Kind
 
 func (c *Card) IsReaction() bool { return c.HasKind(kReaction) }
 func (c *Card) IsVictory() bool  { return c.HasKind(kVictory) }
 func (c *Card) IsTreasure() bool { return c.HasKind(kTreasure) }
 func (c *Card) IsAction() bool   { return c.HasKind(kAction) }
+func (c *Card) IsAttack() bool   { return c.HasKind(kAttack) }
 
 func GetCard(s string) *Card {
 	c, ok := CardDict[s]
@@ -71,13 +79,13 @@ func GetCard(s string) *Card {
 	return c
 }
 
-func (deck Pile) shuffle() {
+func (deck Pile) shuffle(r *rand.Rand) {
 	if len(deck) < 1 {
 		return
 	}
-	n := rand.Intn(len(deck))
+	n := r.Intn(len(deck))
 	deck[0], deck[n] = deck[n], deck[0]
-	deck[1:].shuffle()
+	deck[1:].shuffle(r)
 }
 
 func (deck *Pile) AddCard(s string) {
@@ -97,14 +105,17 @@ type Game struct {
 	p          *Player // Current player.
 	a, b, c    int     // Actions, Buys, Coins,
 	suplist    Pile
+	supply     map[*Card]int  // Cards left in each supply pile.
+	keys       map[*Card]byte // Keys that select cards on the console.
 	ch         chan Command
 	phase      int
 	stack      []*Frame
 	trash      Pile
 	sendCmd    func(game *Game, p *Player, cmd *Command)
 	isServer   bool
-	fetch      func() []string
+	fetch      func() message
 	GetDiscard func(game *Game, p *Player) string
+	sendChat   func(game *Game, p *Player, text string) error // Nil if no one hears.
 
 	noAttack bool
 
@@ -117,7 +128,57 @@ type Game struct {
 
 	discount int
 
+	// Every shuffle draws from rng, so a game is determined by its seed
+	// and the commands sent to it.
+	seed  int64
+	rng   *rand.Rand
+	draws *countingSource // The source of rng.
+
+	// Turns started so far, and if positive, the most the game may last.
+	turn     int
+	maxTurns int
+
+	rec    io.Writer // If non-nil, receives a record of the game.
+	replay *Replay   // If non-nil, supplies shuffles instead of rng.
+
+	// If non-empty, the game is saved here before each top-level command.
+	saveFile string
+
+	// If non-nil, the preset each game starts with, rather than a random
+	// one.
+	preset *Preset
+
+	// Rules for random kingdoms, and whether each game starts with one.
+	kingdom   kingdomRules
+	randomize bool
+
+	// Suppresses events, for example while undone commands are redone.
+	quiet bool
+
+	// What players are being asked; see decider.go.
+	decision *Decision
+
+	// Undo state; see undo.go. Set noUndo if no one will ask to undo,
+	// to save taking snapshots.
+	noUndo       bool
+	undo         []undoPoint
+	hidden       int
+	redo         []Command
+	redoShuffles []Pile
+
 	data map[string]interface{}
+
+	// Listeners; see events.go.
+	subMu sync.Mutex
+	subs  []chan Event
+
+	// Remote spectators, also under subMu; see spectate.go.
+	watchers, pending []*Player
+
+	// Remote players join from other goroutines until setup ends, so
+	// until then players is under seatMu; see sit.
+	seatMu sync.Mutex
+	closed bool // Setup has ended, and no one else may sit.
 }
 
 var newGameHooks []func(*Game)
@@ -134,7 +195,7 @@ func HookTurn(fun func(*Game))    { turnHooks = append(turnHooks, fun) }
 func HookAttack(fun func(*Game))  { attackHooks = append(attackHooks, fun) }
 
 func HookBuy(fun func(*Game, *Card))   { buyHooks = append(buyHooks, fun) }
-func HookGain(fun func(*Game, *Card))   { gainHooks = append(gainHooks, fun) }
+func HookGain(fun func(*Game, *Card))  { gainHooks = append(gainHooks, fun) }
 func HookClean(fun func(*Game, *Card)) { cleanHooks = append(cleanHooks, fun) }
 
 const (
@@ -146,7 +207,13 @@ const (
 
 func (game *Game) TrashCard(p *Player, c *Card) {
 	game.trash.Add(c)
-	game.Report(Event{s: "trash", n: p.n, card: c})
+	for i, x := range p.manifest {
+		if x == c {
+			p.manifest = append(p.manifest[:i], p.manifest[i+1:]...)
+			break
+		}
+	}
+	game.Report(TrashEvent{p.n, c})
 }
 
 func (game *Game) TrashList(p *Player, list Pile) {
@@ -158,11 +225,20 @@ func (game *Game) TrashList(p *Player, list Pile) {
 func (game *Game) DiscardList(p *Player, list Pile) Pile {
 	if len(list) > 0 {
 		p.discard.Add(list...)
-		game.Report(Event{s: "discard", n: p.n, i: len(list)})
+		game.reportDiscard(p, len(list), false)
 	}
 	return list
 }
 
+// reportDiscard reports that p discarded count cards, or the deck.
+func (game *Game) reportDiscard(p *Player, count int, deck bool) {
+	ev := DiscardEvent{n: p.n, count: count, deck: deck}
+	if game.listened() {
+		ev.top = game.GetDiscard(game, p)
+	}
+	game.Report(ev)
+}
+
 func (game *Game) SetTrashMe() {
 	frame := game.StackTop()
 	frame.popHook = func() { game.TrashCard(game.p, frame.card) }
@@ -188,7 +264,7 @@ func (game *Game) Cost(c *Card) int {
 func (game *Game) dump() {
 	cols := []int{3, 3, 1, 3, 3, 3, 1}
 	for _, c := range game.suplist {
-		fmt.Printf("  [%c] %v(%v) $%v", c.key, c.name, c.supply, game.Cost(c))
+		fmt.Printf("  [%c] %v(%v) $%v", game.keys[c], c.name, game.supply[c], game.Cost(c))
 		cols[0]--
 		if cols[0] == 0 {
 			fmt.Println()
@@ -215,11 +291,11 @@ func (p *Player) InitDeck() {
 	}
 }
 
-func (p *Player) dumpHand() {
+func (game *Game) dumpHand(p *Player) {
 	fmt.Println("Hand:")
 	n := 0
 	for _, c := range p.hand {
-		fmt.Printf(" [%c] %v", c.key, c.name)
+		fmt.Printf(" [%c] %v", game.keys[c], c.name)
 		n = (n + 1) % 5
 		if n == 0 {
 			println()
@@ -239,7 +315,7 @@ func (p *Player) dumpHand() {
 
 func (game *Game) keyToCard(key byte) *Card {
 	for _, c := range game.suplist {
-		if key == c.key {
+		if key == game.keys[c] {
 			return c
 		}
 	}
@@ -253,9 +329,9 @@ func (game *Game) MultiPlay(p *Player, c *Card, m int) {
 	frame := &Frame{card: c}
 	game.stack = append(game.stack, frame)
 	for ; m > 0; m-- {
-		fmt.Printf("%v plays %v\n", p.name, c.name)
+		game.Printf("%v plays %v\n", p.name, c.name)
 		if c.act == nil {
-			fmt.Printf("%v unimplemented  :(\n", c.name)
+			game.Printf("%v unimplemented  :(\n", c.name)
 			return
 		}
 		for _, f := range c.act {
@@ -285,6 +361,7 @@ func (game *Game) Play(c *Card) {
 	if c.IsAction() {
 		game.a--
 	}
+	game.Report(PlayEvent{p.n, c})
 	game.MultiPlay(p, c, 1)
 }
 
@@ -339,41 +416,85 @@ type Player struct {
 	fun     PlayFun
 	trigger chan bool // When triggered, Player sends a Command on game.ch.
 	// TODO: Move recv to netGamer?
-	recv   chan string // For sending decisions to remote clients.
-	herald chan Event  // Events that may be worth printing.
+	recv chan message // For sending decisions to remote clients.
+	gone chan bool    // Closed when a spectator leaves; nil for players.
 
-	manifest, deck, hand, played, discard Pile
-}
+	turns int // Turns taken, for breaking ties.
 
-type Event struct {
-	s    string
-	card *Card
-	n    int
-	i    int
-	cmd  string
+	manifest, deck, hand, played, discard Pile
 }
 
-// MaybeShuffle returns true if deck is non-empty, shuffling the discards
-// into a new deck if necessary.
-func (p *Player) MaybeShuffle() bool {
+// MaybeShuffle returns true if the deck of p is non-empty, shuffling the
+// discards into a new deck if necessary.
+func (game *Game) MaybeShuffle(p *Player) bool {
 	if len(p.deck) == 0 {
 		if len(p.discard) == 0 {
 			return false
 		}
 		p.deck, p.discard = p.discard, nil
-		p.deck.shuffle()
+		game.shuffle(p.deck)
 	}
 	return true
 }
 
-func (game *Game) Report(ev Event) {
-	for _, p := range game.players {
-		if p.herald != nil {
-			p.herald <- ev
-			if (<-game.ch).s != "ack" {
-				panic("expected ack")
-			}
-		}
+func (game *Game) shuffle(deck Pile) {
+	switch {
+	case len(game.redoShuffles) > 0:
+		copy(deck, game.redoShuffles[0])
+		game.redoShuffles = game.redoShuffles[1:]
+	case game.replay != nil:
+		game.replay.shuffle(deck)
+		game.record("shuffle", deck)
+	default:
+		deck.shuffle(game.rng)
+		game.record("shuffle", deck)
+	}
+	game.hide()
+	if n := len(game.undo); n > 0 {
+		game.undo[n-1].shuffles = append(game.undo[n-1].shuffles, append(Pile{}, deck...))
+	}
+}
+
+// Seed resets the random source of the game.
+func (game *Game) Seed(seed int64) {
+	game.seed = seed
+	game.draws = &countingSource{src: rand.NewSource(seed).(rand.Source64)}
+	game.rng = rand.New(game.draws)
+}
+
+// countingSource is a random source that counts the values drawn from
+// it, so that a game can be saved without disturbing its shuffles.
+type countingSource struct {
+	src rand.Source64
+	n   int64
+}
+
+func (s *countingSource) Int63() int64 {
+	s.n++
+	return s.src.Int63()
+}
+
+func (s *countingSource) Uint64() uint64 {
+	s.n++
+	return s.src.Uint64()
+}
+
+func (s *countingSource) Seed(seed int64) {
+	s.src.Seed(seed)
+	s.n = 0
+}
+
+// skip draws n values, to move to where a saved source was.
+func (s *countingSource) skip(n int64) {
+	for ; n > 0; n-- {
+		s.Int63()
+	}
+}
+
+// Printf describes what happens in the game to its listeners.
+func (game *Game) Printf(format string, a ...interface{}) {
+	if game.listened() {
+		game.Report(TextEvent{fmt.Sprintf(format, a...)})
 	}
 }
 
@@ -381,64 +502,68 @@ func (game *Game) draw(p *Player, n int) int {
 	count := 0
 	if n > 0 {
 		if game.isServer {
-			s := ""
-			sSecret := ""
+			var drawn Pile
 			i := 0
-			for ; i < n && p.MaybeShuffle(); i++ {
+			for ; i < n && game.MaybeShuffle(p); i++ {
 				c := p.deck[0]
 				p.deck, p.hand = p.deck[1:], append(p.hand, c)
-				s += string(c.key)
-				sSecret += "?"
+				drawn.Add(c)
 			}
-			game.castCond(func(x *Player) bool { return x == p }, "draw", s)
-			game.castCond(func(x *Player) bool { return x != p }, "draw", sSecret)
+			game.castCond(func(x *Player) bool { return x == p }, cardMessage("draw", drawn...))
+			game.castCond(func(x *Player) bool { return x != p }, cardMessage("draw", make(Pile, len(drawn))...))
 			count = i
+			if count > 0 {
+				game.hide()
+			}
 		} else {
-			w := game.fetch()
-			for _, b := range []byte(w[0]) {
+			drawn := game.fetch().pile()
+			for _, c := range drawn {
 				if len(p.deck) == 0 {
 					p.deck, p.discard = p.discard, nil
 				}
 				p.deck = p.deck[1:]
-				if b != '?' {
-					p.hand.Add(game.keyToCard(b))
-				} else {
-					p.hand.Add(nil)
-				}
+				p.hand.Add(c)
 			}
-			count = len(w[0])
+			count = len(drawn)
+		}
+		if count > 0 {
+			game.Report(DrawEvent{p.n, append(Pile{}, p.hand[len(p.hand)-count:]...)})
 		}
-		game.Report(Event{s: "draw", n: p.n, i: count})
 	}
 	return count
 }
 
 func (game *Game) reveal(p *Player) *Card {
-	if !p.MaybeShuffle() {
+	if !game.MaybeShuffle(p) {
 		log.Fatalf("should check for empty deck before reveal")
 	}
+	game.hide()
 	if game.isServer {
 		c := p.deck[0]
-		fmt.Printf("%v reveals %v\n", p.name, c.name)
-		game.cast("reveal", c)
+		game.Printf("%v reveals %v\n", p.name, c.name)
+		game.cast(cardMessage("reveal", c))
+		game.Report(RevealEvent{p.n, Pile{c}})
 		return c
 	}
-	c := game.keyToCard(game.fetch()[0][0])
-	fmt.Printf("%v reveals %v\n", p.name, c.name)
+	c := game.fetch().card()
+	game.Printf("%v reveals %v\n", p.name, c.name)
+	game.Report(RevealEvent{p.n, Pile{c}})
 	return c
 }
 
 func (game *Game) revealHand(p *Player) {
+	game.hide()
 	for i, c := range p.hand {
 		if game.isServer {
-			game.cast("revealHand", c)
+			game.cast(cardMessage("revealHand", c))
 		} else {
-			p.hand[i] = game.keyToCard(game.fetch()[0][0])
+			p.hand[i] = game.fetch().card()
 		}
 	}
 	for _, c := range p.hand {
-		fmt.Printf("%v reveals %v\n", p.name, c.name)
+		game.Printf("%v reveals %v\n", p.name, c.name)
 	}
+	game.Report(RevealEvent{p.n, append(Pile{}, p.hand...)})
 }
 
 func (game *Game) Cleanup() {
@@ -453,26 +578,67 @@ func (game *Game) Cleanup() {
 	p.played, p.hand = nil, nil
 }
 
-func (game *Game) cast(comment string, vs ...interface{}) {
-	game.castCond(func(*Player) bool { return true }, comment, vs...)
+func (game *Game) cast(m message) {
+	game.castCond(func(*Player) bool { return true }, m)
 }
 
-func (game *Game) castCond(cond func(*Player) bool, comment string, vs ...interface{}) {
+func (game *Game) castCond(cond func(*Player) bool, m message) {
 	if !game.isServer {
 		log.Fatal("nonserver cast")
 	}
-	s := comment
-	for _, v := range vs {
-		switch t := v.(type) {
-		default:
-			s += fmt.Sprintf(";%v", t)
-		case *Card:
-			s += fmt.Sprintf(";%c", t.key)
+	for _, p := range game.seated() {
+		if cond(p) && p.recv != nil {
+			game.send(p, m)
 		}
 	}
-	for _, p := range game.players {
-		if cond(p) && p.recv != nil {
-			p.recv <- s
+	for _, w := range game.watching() {
+		if cond(w) {
+			game.send(w, m)
+		}
+	}
+}
+
+// send gives m to a remote player or spectator, unless the spectator
+// has left.
+func (game *Game) send(p *Player, m message) {
+	select {
+	case p.recv <- m:
+	case <-p.gone:
+	}
+}
+
+// checkpoint gives each remote player and spectator the game as they see
+// it, from which their client can be rebuilt if it reconnects. New
+// spectators join here.
+func (game *Game) checkpoint() {
+	if !game.isServer {
+		return
+	}
+	for _, p := range game.recipients() {
+		if p.recv == nil {
+			continue
+		}
+		sg, err := game.snapshot(p)
+		if err != nil {
+			panic(err)
+		}
+		game.send(p, message{Type: "mark", View: sg})
+	}
+	for _, w := range game.admit() {
+		sg, err := game.snapshot(w)
+		if err != nil {
+			panic(err)
+		}
+		game.send(w, message{Type: "resume", View: sg})
+	}
+}
+
+// chat passes on what someone said to the listeners and remote clients.
+func (game *Game) chat(from, text string) {
+	game.Report(ChatEvent{from, text})
+	for _, p := range game.recipients() {
+		if p.recv != nil {
+			game.send(p, message{Type: "chat", From: from, Text: text})
 		}
 	}
 }
@@ -527,54 +693,75 @@ func CanBuy(game *Game, c *Card) string {
 		return "no buys left"
 	case game.Cost(c) > game.c:
 		return "insufficient money"
-	case c.supply == 0:
+	case game.supply[c] == 0:
 		return "supply exhausted"
 	}
 	return ""
 }
 
-func (game *Game) Over() {
-	fmt.Printf("Game over\n")
-	game.runHooks(endGameHooks)
-	for _, p := range game.players {
-		game.p = p // Require current player for some VP computations.
-		score := 0
-		m := make(map[*Card]struct {
-			count, pts int
-		})
-		for _, c := range p.manifest {
-			if c.IsVictory() || c.HasKind(kCurse) {
-				if c.vp == nil {
-					fmt.Printf("%v unimplemented  :(\n", c.name)
-					continue
+// getCommand asks p for a command. On the server, check says what is
+// wrong with a command, if anything; bad commands are refused, and never
+// reach the game or the other players.
+func (game *Game) getCommand(p *Player, check func(Command) string) Command {
+	var cmd Command
+	if len(game.redo) > 0 {
+		cmd, game.redo = game.redo[0], game.redo[1:]
+	} else {
+		game.quiet = false
+		for {
+			p.trigger <- true
+			cmd = <-game.ch
+			if cmd.s == "undo" {
+				msg := "cannot undo: " + game.rollback(p)
+				if p.recv != nil {
+					game.refuse(p, cmd, msg)
+				} else {
+					game.Report(RefusedEvent{p.n, msg})
 				}
-				n := c.vp(game)
-				v := m[c]
-				v.count++
-				v.pts += n
-				m[c] = v
-				score += n
+				continue
 			}
-		}
-		fmt.Printf("%v: %v\n", p.name, score)
-		for _, c := range game.suplist {
-			if c.IsVictory() || c.HasKind(kCurse) {
-				v := m[c]
-				fmt.Printf("%v x %v = %v\n", v.count, c.name, v.pts)
+			msg := ""
+			switch {
+			case !game.isServer:
+			case cmd.s == "quit":
+				if p.recv != nil {
+					msg = "remote players cannot end the game"
+				}
+			case check != nil:
+				msg = check(cmd)
+			}
+			if msg == "" {
+				break
 			}
+			game.refuse(p, cmd, msg)
+		}
+		if game.phase != phSetup {
+			// The record header summarises setup commands.
+			game.record("cmd", p.n, cmd.s, cmd.i, cmd.c)
 		}
+		game.sendCmd(game, p, &cmd)
+	}
+	if n := len(game.undo); n > 0 && game.phase != phSetup {
+		game.undo[n-1].cmds = append(game.undo[n-1].cmds, undoCmd{p, cmd, game.hidden})
 	}
+	if cmd.s == "quit" && game.phase != phSetup {
+		panic(quitGame{})
+	}
+	return cmd
 }
 
-func (game *Game) getCommand(p *Player) Command {
-	p.trigger <- true
-	cmd := <-game.ch
-	game.sendCmd(game, p, &cmd)
-	if cmd.s == "quit" {
-		game.Over()
-		os.Exit(0)
+// quitGame is the panic value that ends a game a local player quits. A
+// quit during setup is returned like any other command.
+type quitGame struct{}
+
+// refuse tells p why cmd is bad, before p is asked again. Local players
+// are trusted to check their own commands, so for them it is a bug.
+func (game *Game) refuse(p *Player, cmd Command, msg string) {
+	if p.recv == nil {
+		panic(fmt.Sprintf("%v: bad command %q: %v", p.name, cmd.s, msg))
 	}
-	return cmd
+	log.Printf("%v: bad command %q: %v", p.name, cmd.s, msg)
+	p.recv <- message{Type: "error", Error: msg}
 }
 
 func (game *Game) pickHand(p *Player, s string) Pile {
@@ -645,21 +832,22 @@ func (game *Game) split(list Pile, p *Player, cond string) (Pile, Pile) {
 					out.Add(c)
 				}
 			}
-			game.cast("max", "forced", n, prev)
+			m := cardMessage("max", prev)
+			m.N, m.Forced = n, true
+			game.cast(m)
 			return in, out
 		}
-		game.cast("max", "", n)
+		game.cast(message{Type: "max", N: n})
 	} else {
-		v := game.fetch()
-		if v[0] == "forced" {
-			n = PanickyAtoi(v[1])
-			c := game.keyToCard(v[2][0])
+		m := game.fetch()
+		n = m.N
+		if m.Forced {
+			c := m.card()
 			for i := 0; i < n; i++ {
 				in = append(in, c)
 			}
 			return in, list[n:]
 		}
-		n = PanickyAtoi(v[1])
 	}
 	if n == 0 {
 		return in, list
@@ -696,8 +884,35 @@ func (game *Game) split(list Pile, p *Player, cond string) (Pile, Pile) {
 		}
 		return Command{s: "pick", c: choice}, ""
 	})
+	check := func(cmd Command) string {
+		switch cmd.s {
+		case "pick":
+			if cmd.c == nil || !satisfied(v[1:], cmd.c) {
+				return "invalid choice"
+			}
+			for _, c := range out {
+				if c == cmd.c {
+					return ""
+				}
+			}
+			return "invalid choice"
+		case "done":
+			if exact && n > 0 {
+				return "must pick more"
+			}
+			return ""
+		}
+		return "bad command: " + cmd.s
+	}
+	d := &Decision{kind: decSplit, prompt: prompt, n: n, exact: exact}
+	for _, c := range out {
+		if c != nil && satisfied(v[1:], c) {
+			d.options = append(d.options, c)
+		}
+	}
+	game.ask(d)
 	for stop := false; !stop; {
-		cmd := game.getCommand(p)
+		cmd := game.getCommand(p, check)
 		switch cmd.s {
 		case "pick":
 			found := false
@@ -714,6 +929,12 @@ func (game *Game) split(list Pile, p *Player, cond string) (Pile, Pile) {
 			if !found {
 				panic("invalid selection")
 			}
+			for i, c := range d.options {
+				if c == cmd.c {
+					d.options = append(d.options[:i:i], d.options[i+1:]...)
+					break
+				}
+			}
 			stop = n == 0
 		case "done":
 			if exact && n > 0 {
@@ -728,22 +949,22 @@ func (game *Game) split(list Pile, p *Player, cond string) (Pile, Pile) {
 }
 
 func (game *Game) panickyGain(p *Player, c *Card) {
-	if c.supply == 0 {
+	if game.supply[c] == 0 {
 		panic("out of supply")
 	}
-	game.Report(Event{s: "gain", n: p.n, card: c})
+	game.Report(GainEvent{p.n, c})
 	p.discard.Add(c)
-	c.supply--
+	p.manifest.Add(c)
+	game.supply[c]--
 	for _, hook := range gainHooks {
 		hook(game, c)
 	}
 }
 
+// MaybeGain gains c if it is in the supply. A nil c, as from a pick when
+// nothing can be picked, gains nothing.
 func (game *Game) MaybeGain(p *Player, c *Card) bool {
-	if c == nil {
-		panic("unreachable")
-	}
-	if c.supply == 0 {
+	if c == nil || game.supply[c] == 0 {
 		return false
 	}
 	game.panickyGain(p, c)
@@ -782,7 +1003,7 @@ func pickCard(game *Game, p *Player, o CardOpts) *Card {
 			return "too expensive"
 		case o.exact && game.Cost(c) < o.cost:
 			return "too cheap"
-		case c.supply == 0:
+		case game.supply[c] == 0:
 			return "supply exhausted"
 		case o.cond != nil:
 			if msg := o.cond(c); msg != "" {
@@ -837,7 +1058,19 @@ func pickCard(game *Game, p *Player, o CardOpts) *Card {
 		}
 		return Command{s: "pick", c: c}, ""
 	})
-	cmd := game.getCommand(p)
+	d := &Decision{kind: decSupply, prompt: prompt, optional: o.optional}
+	for _, c := range game.suplist {
+		if isValid(c) == "" {
+			d.options = append(d.options, c)
+		}
+	}
+	game.ask(d)
+	cmd := game.getCommand(p, func(cmd Command) string {
+		if cmd.s != "pick" {
+			return "bad command: " + cmd.s
+		}
+		return isValid(cmd.c)
+	})
 	if cmd.s != "pick" {
 		panic("bad command: " + cmd.s)
 	}
@@ -870,15 +1103,10 @@ func (p *Player) inHand(cond func(*Card) bool) bool {
 
 func (game *Game) inHand(p *Player, cond func(*Card) bool) bool {
 	if !game.isServer {
-		return game.fetch()[0] == "1"
+		return game.fetch().Yes
 	}
 	res := p.inHand(cond)
-	game.cast("inhand", func() int {
-		if res {
-			return 1
-		}
-		return 0
-	}())
+	game.cast(message{Type: "inhand", Yes: res})
 	return res
 }
 
@@ -894,7 +1122,7 @@ func (game *Game) reactCheck(p *Player) {
 			return
 		}
 		c := selected[0]
-		fmt.Printf("%v reveals %v\n", p.name, c.name)
+		game.Printf("%v reveals %v\n", p.name, c.name)
 		c.react(game, p)
 	}
 }
@@ -908,7 +1136,7 @@ func (game *Game) ForOthers(fun func(*Player)) {
 
 func (game *Game) attack(fun func(*Player)) {
 	game.ForOthers(func(other *Player) {
-		fmt.Printf("%v attacks %v\n", game.p.name, other.name)
+		game.Printf("%v attacks %v\n", game.p.name, other.name)
 		game.reactCheck(other)
 		if game.noAttack {
 			return
@@ -917,7 +1145,8 @@ func (game *Game) attack(fun func(*Player)) {
 	})
 }
 
-func (game *Game) getBool(p *Player, prompt string) bool {
+// getBool asks p a yes or no question, about the shown cards if any.
+func (game *Game) getBool(p *Player, prompt string, shown ...*Card) bool {
 	game.SetParse(prompt, func(b byte) (Command, string) {
 		switch b {
 		case 'y':
@@ -931,7 +1160,13 @@ func (game *Game) getBool(p *Player, prompt string) bool {
 		}
 		return errCmd, "y for yes, n for no"
 	})
-	cmd := game.getCommand(p)
+	game.ask(&Decision{kind: decBool, prompt: prompt, shown: shown})
+	cmd := game.getCommand(p, func(cmd Command) string {
+		if cmd.s != "yes" && cmd.s != "done" {
+			return "bad command: " + cmd.s
+		}
+		return ""
+	})
 	switch cmd.s {
 	case "yes":
 		return true
@@ -942,12 +1177,14 @@ func (game *Game) getBool(p *Player, prompt string) bool {
 }
 
 type CardDB struct {
-	List    string
-	Fun     map[string]func(*Game)
-	VP      map[string]func(*Game) int
-	React   map[string]func(*Game, *Player)
-	Presets string
-	Setup   func()
+	Name     string // Of the expansion.
+	List     string
+	Fun      map[string]func(*Game)
+	VP       map[string]func(*Game) int
+	React    map[string]func(*Game, *Player)
+	Duration map[string]func(*Game, Pile)
+	Presets  string
+	Setup    func()
 }
 
 type Preset struct {
@@ -958,6 +1195,7 @@ type Preset struct {
 var presets []Preset
 
 func loadDB(db CardDB) {
+	cardSets = append(cardSets, db.Name)
 	for _, s := range strings.Split(db.List, "\n") {
 		if len(s) == 0 {
 			continue
@@ -973,7 +1211,7 @@ func loadDB(db CardDB) {
 		if err != nil {
 			panic(s)
 		}
-		c := &Card{name: a[0], cost: cost}
+		c := &Card{name: a[0], cost: cost, set: db.Name}
 		for _, s := range strings.Split(a[2], "-") {
 			kind, ok := KindDict[s]
 			if !ok {
@@ -987,16 +1225,20 @@ func loadDB(db CardDB) {
 			s := a[i]
 			switch s[0] {
 			case '$':
+				c.coin += PanickyAtoi(s[1:])
 				add(func(game *Game) { game.addCoins(PanickyAtoi(s[1:])) })
 			case '#':
 				c.vp = func(game *Game) int { return PanickyAtoi(s[1:]) }
 			case '+':
 				switch s[1] {
 				case 'A':
+					c.actions += PanickyAtoi(s[2:])
 					add(func(game *Game) { game.addActions(PanickyAtoi(s[2:])) })
 				case 'B':
+					c.buys += PanickyAtoi(s[2:])
 					add(func(game *Game) { game.addBuys(PanickyAtoi(s[2:])) })
 				case 'C':
+					c.cards += PanickyAtoi(s[2:])
 					add(func(game *Game) { game.addCards(PanickyAtoi(s[2:])) })
 				default:
 					panic(s)
@@ -1016,6 +1258,9 @@ func loadDB(db CardDB) {
 	for name, fun := range db.React {
 		GetCard(name).react = fun
 	}
+	for name, fun := range db.Duration {
+		GetCard(name).duration = fun
+	}
 	for _, line := range strings.Split(db.Presets, "\n") {
 		if len(line) == 0 {
 			continue
@@ -1049,6 +1294,7 @@ func init() {
 	kVictory = getKind("Victory")
 	kCurse = getKind("Curse")
 	kAction = getKind("Action")
+	kAttack = getKind("Attack")
 	kReaction = getKind("Reaction")
 	loadDB(cardsBase)
 	loadDB(cardsIntrigue)
@@ -1059,157 +1305,301 @@ func main() {
 	runtime.GOMAXPROCS(4)
 
 	log.SetFlags(log.Lshortfile)
+	seed := flag.Int64("seed", 0, "random seed for the first game; 0 picks one from the clock")
+	record := flag.String("record", "", "directory in which to record games")
+	replayFile := flag.String("replay", "", "replay a recorded game")
+	stop := flag.Int("turn", 0, "stop a replay when this turn begins")
+	saveFile := flag.String("save", "", "file in which to keep saving the game in progress")
+	resumeFile := flag.String("resume", "", "resume a saved game; remote players rejoin under their old names")
+	name := flag.String("name", "", "name to join a server with; random if empty")
+	tableNum := flag.Int("table", 1, "table to join on a server; 0 opens a new one")
+	token := flag.String("token", "", "session token with which to rejoin a table after losing the connection")
+	watch := flag.Bool("watch", false, "watch a table on a server without playing")
+	configFile := flag.String("config", "", "JSON file of settings for serving; see config.go. Flags override it")
+	addr := flag.String("addr", defaultConfig.Addr, "address on which to listen for remote players")
+	var seats seatList
+	flag.Var(&seats, "seat", "a local seat, once per seat: a name to play at the console, or name=bot as for sim (default Ben and AI=Province, Gold, Silver)")
+	presetName := flag.String("preset", "", "preset of each game, or \"random\" for a random kingdom; a random preset if empty")
+	numGames := flag.Int("games", 0, "games to play before exiting; 0 for no end")
+	cardDir := flag.String("cards", "", "directory of card files to load; see cardfile.go")
 	flag.Parse()
+	if *cardDir != "" {
+		if err := readCards(*cardDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *replayFile != "" {
+		replay(*replayFile, *stop)
+		return
+	}
+	if flag.Arg(0) == "sim" {
+		sim(flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "tournament" {
+		tournament(flag.Args()[1:])
+		return
+	}
 	if flag.NArg() > 0 {
-		client(flag.Arg(0))
+		client(flag.Arg(0), *name, *tableNum, *token, *watch)
 		return
 	}
 
-	rand.Seed(time.Now().Unix())
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	cfg := defaultConfig
+	if *configFile != "" {
+		if err := loadConfig(*configFile, &cfg); err != nil {
+			log.Fatal(err)
+		}
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.Addr = *addr
+		case "seat":
+			cfg.Seats = seats
+		case "preset":
+			cfg.Preset = *presetName
+		case "games":
+			cfg.Games = *numGames
+		}
+	})
 	fmt.Println("= Gominion =")
 
-	game := &Game{ch: make(chan Command), isServer: true,
-		sendCmd: func(game *Game, p *Player, cmd *Command) {
-			if cmd.c == nil {
-				game.cast("cmd", cmd.s)
-			} else {
-				game.cast("cmd", cmd.s, cmd.c)
-			}
-		},
-		GetDiscard: func(game *Game, p *Player) string { return p.discard[len(p.discard)-1].name },
+	game := newGame()
+	game.seed = *seed
+	game.saveFile = *saveFile
+	game.kingdom = cfg.Kingdom
+	if _, err := game.kingdom.draw(rand.New(rand.NewSource(1))); err != nil {
+		log.Fatal("random kingdom: ", err)
 	}
-	game.players = []*Player{
-		&Player{name: "Ben", fun: consoleGamer{}, herald: make(chan Event)},
-		&Player{name: "AI", fun: SimpleBuyer{[]string{"Province", "Gold", "Silver"}}},
+	switch {
+	case strings.EqualFold(cfg.Preset, "random"):
+		game.randomize = true
+	case cfg.Preset != "":
+		if game.preset = findPreset(cfg.Preset); game.preset == nil {
+			log.Fatalf("no such preset: %q", cfg.Preset)
+		}
 	}
-	for i, p := range game.players {
-		p.n = i
-		p.trigger = make(chan bool)
-		go p.fun.start(game, p)
+	local, err := cfg.players(game)
+	if err != nil {
+		log.Fatal(err)
 	}
-	clients := make(map[string]*netGamer)
-	http.HandleFunc("/reg", func(w http.ResponseWriter, r *http.Request) {
-		name := r.FormValue("name")
-		if name == "" {
-			fmt.Fprintf(w, "error: nil name")
-			return
+	// Number of remote players yet to rejoin a resumed game.
+	vacant := 0
+	if *resumeFile == "" {
+		game.players = local
+	} else {
+		f, err := os.Open(*resumeFile)
+		if err != nil {
+			log.Fatal(err)
 		}
-		for _, p := range game.players {
-			if p.name == name {
-				fmt.Fprintf(w, "error: name already taken")
-				return
+		err = game.Load(f, func(name string) *Player {
+			for _, p := range local {
+				if p.name == name {
+					return p
+				}
 			}
+			vacant++
+			return &Player{name: name}
+		})
+		f.Close()
+		if err != nil {
+			log.Fatal("resume: ", err)
 		}
-		ng := &netGamer{
-			in:  make(chan Command),
-			out: make(chan string),
-		}
-		clients[name] = ng
-		p := &Player{name: name, n: len(game.players), fun: ng}
+	}
+	for i, p := range game.players {
+		p.n = i
 		p.trigger = make(chan bool)
-		p.recv = make(chan string)
-		game.players = append(game.players, p)
-		go ng.start(game, p)
-		fmt.Fprintf(w, name)
-		fmt.Printf("%v joined\n", name)
-	})
-
-	http.HandleFunc("/discard", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, game.GetDiscard(game, game.players[PanickyAtoi(r.FormValue("n"))]))
-	})
-
-	http.HandleFunc("/poll", func(w http.ResponseWriter, r *http.Request) {
-		ng, ok := clients[r.FormValue("id")]
-		if !ok {
-			fmt.Fprintf(w, "error: no such id")
-			return
-		}
-		ng.in <- Command{s: "poll"}
-		fmt.Fprintf(w, <-ng.out)
-	})
-
-	http.HandleFunc("/cmd", func(w http.ResponseWriter, r *http.Request) {
-		ng, ok := clients[r.FormValue("id")]
-		if !ok {
-			log.Print("error: no such id")
-			fmt.Fprintf(w, "error: no such id")
+		if p.fun != nil {
+			go p.fun.start(game, p)
+		}
+	}
+	// The console players sit at table 1. Remote players may join them or
+	// open tables of their own.
+	lb := newLobby(*record)
+	t := lb.add(game)
+	t.resume = *resumeFile != ""
+	lb.listen(cfg.Addr)
+
+	games := cfg.Games
+	quit := false
+	if t.resume {
+		for ; vacant > 0; vacant-- {
+			<-t.joined
+		}
+		fmt.Printf("Resuming turn %v\n", game.turn)
+		game.dump()
+		quit = game.resume().quit
+		lb.renew(t)
+		game.seed = game.rng.Int63()
+		if games--; games == 0 {
 			return
 		}
-		s := r.FormValue("s")
-		if s == "" {
-			log.Print("error: no command")
-			fmt.Fprintf(w, "error: no command")
-			return
-		}
-		cmd := Command{s: s}
-		if c := r.FormValue("c"); c != "" {
-			if len(c) != 1 {
-				fmt.Fprintf(w, "error: malformed card")
-			}
-			cmd.c = game.keyToCard(c[0])
-			if cmd.c == nil {
-				fmt.Fprintf(w, "error: no such card")
-				return
-			}
-		}
-		ng.in <- cmd
-		fmt.Fprintf(w, <-ng.out)
-	})
-
-	go func() { log.Fatal(http.ListenAndServe(":8080", nil)) }()
-	time.Sleep(8 * time.Millisecond)
-	for n := 0; ; n++ {
-		resp, err := http.Get("http://:8080/")
-		if err != nil {
-			if n > 3 {
-				log.Fatal("failed to connect 3 times: ", err)
-			}
-			time.Sleep(1 * time.Second)
-			continue
-		}
-		defer resp.Body.Close()
-		break
 	}
+	if !quit {
+		quit = lb.serve(t, games)
+	}
+	// A quit ends only the console's table.
+	if n := lb.count() - 1; quit && n > 0 {
+		fmt.Printf("Still serving %v other table(s); interrupt to stop\n", n)
+		select {}
+	}
+}
 
-	for {
-		singleGame(game)
+// newGame returns a game run by this process.
+func newGame() *Game {
+	return &Game{ch: make(chan Command), isServer: true,
+		sendCmd: func(game *Game, p *Player, cmd *Command) {
+			game.cast(message{Type: "cmd", Cmd: encodeCommand(*cmd)})
+		},
+		GetDiscard: func(game *Game, p *Player) string { return p.discard[len(p.discard)-1].name },
+		sendChat: func(game *Game, p *Player, text string) error {
+			game.chat(p.name, text)
+			return nil
+		},
 	}
 }
 
 func (game *Game) Reset() {
 	game.phase = phSetup
+	game.turn = 0
+	game.undo = nil
 	game.suplist = nil
+	game.supply = make(map[*Card]int)
+	game.keys = make(map[*Card]byte)
 	game.trash = nil
+	game.seatMu.Lock()
+	game.closed = false
+	game.seatMu.Unlock()
 }
 
-func singleGame(game *Game) {
+// Most players a game can have.
+const maxPlayers = 6
+
+var errInProgress = errors.New("game in progress")
+
+// sit adds p to the players, unless the game has started or is full. It
+// may be called from any goroutine.
+func (game *Game) sit(p *Player) error {
+	game.seatMu.Lock()
+	defer game.seatMu.Unlock()
+	switch {
+	case game.closed:
+		return errInProgress
+	case len(game.players) >= maxPlayers:
+		return errors.New("table full")
+	}
+	p.n = len(game.players)
+	game.players = append(game.players, p)
+	return nil
+}
+
+// seated returns the players, who may still be joining.
+func (game *Game) seated() []*Player {
+	game.seatMu.Lock()
+	defer game.seatMu.Unlock()
+	return append([]*Player(nil), game.players...)
+}
+
+// closeSeats ends setup, after which no one may sit, unless there are
+// too few or too many players to deal.
+func (game *Game) closeSeats() error {
+	game.seatMu.Lock()
+	defer game.seatMu.Unlock()
+	switch n := len(game.players); {
+	case n < 2:
+		return errors.New("need at least 2 players")
+	case n > maxPlayers:
+		return fmt.Errorf("at most %v players", maxPlayers)
+	}
+	game.closed = true
+	return nil
+}
+
+// singleGame sets up a game, with the first player choosing the kingdom
+// and when to start, and plays it.
+func singleGame(game *Game) *Result {
 	game.Reset()
-	fmt.Println("Available presets:")
+	game.Seed(game.seed)
+	game.Printf("Seed: %v\n", game.seed)
+	game.Printf("Available presets:\n")
 	for _, pr := range presets {
-		fmt.Printf("  %v", pr.name)
+		game.Printf("  %v", pr.name)
+	}
+	game.Printf("\n")
+	pr := presets[game.rng.Intn(len(presets))]
+	if game.preset != nil {
+		pr = *game.preset
+	}
+	random := func() {
+		k, err := game.kingdom.draw(game.rng)
+		if err != nil {
+			game.Printf("random kingdom: %v\n", err)
+			return
+		}
+		pr = k
+		game.Printf("Playing %v\n", strings.Join(pileNames(pr.cards, false), ", "))
+	}
+	if game.randomize {
+		random()
 	}
-	fmt.Println()
-	pr := presets[rand.Intn(len(presets))]
 
+	p := game.seated()[0]
 	for {
-		p := game.players[0]
-		cmd := game.getCommand(p)
+		cmd := game.getCommand(p, func(cmd Command) string {
+			switch cmd.s {
+			case "start", "random":
+				return ""
+			case "preset":
+				if cmd.i < 0 || cmd.i >= len(presets) {
+					return "no such preset"
+				}
+				return ""
+			}
+			return "bad command: " + cmd.s
+		})
+		if cmd.s == "quit" {
+			return &Result{quit: true}
+		}
 		if cmd.s == "start" {
-			break
+			err := game.closeSeats()
+			if err == nil {
+				break
+			}
+			game.Printf("%v\n", err)
+			continue
 		}
 		switch cmd.s {
 		case "preset":
 			pr = presets[cmd.i]
-			fmt.Printf("Playing %q\n", pr.name)
+			game.Printf("Playing %q\n", pr.name)
+		case "random":
+			random()
 		}
 	}
+	game.recordHeader(pr)
+	game.deal(pr)
+	game.admit()
+	for _, p := range game.recipients() {
+		if p.recv != nil {
+			game.send(p, newGameMessage(game, p))
+		}
+	}
+	game.dump()
+	return game.mainloop()
+}
 
+// deal lays out the supply for the preset and deals starting hands.
+func (game *Game) deal(pr Preset) {
 	setSupply := func(s string, n int) {
 		c, ok := CardDict[s]
 		if !ok {
 			panic("no such card: " + s)
 		}
-		c.supply = n
+		game.supply[c] = n
 	}
 	setSupply("Copper", 60-7*len(game.players))
 	setSupply("Silver", 40)
@@ -1238,7 +1628,7 @@ func singleGame(game *Game) {
 	layout := func(s string, key byte) {
 		c := GetCard(s)
 		game.suplist = append(game.suplist, c)
-		c.key = key
+		game.keys[c] = key
 	}
 	layout("Copper", '1')
 	layout("Silver", '2')
@@ -1251,26 +1641,20 @@ func singleGame(game *Game) {
 
 	for i, c := range pr.cards {
 		if c.IsVictory() {
-			c.supply = numVictoryCards
+			game.supply[c] = numVictoryCards
 		} else {
-			c.supply = 10
+			game.supply[c] = 10
 		}
 		layout(c.name, keys[i])
 	}
 	for _, p := range game.players {
 		p.InitDeck()
+		p.turns = 0
 		p.deck = nil
 		p.deck = append(p.deck, p.manifest...)
-		p.deck.shuffle()
+		game.shuffle(p.deck)
 		p.hand, p.deck, p.played, p.discard = p.deck[:5], p.deck[5:], nil, nil
 	}
-	for _, p := range game.players {
-		if p.recv != nil {
-			p.recv <- "new\n= Players =\n" + encodePlayers(game.players) + "= Kingdom =\n" + encodeKingdom(game) + "= Hand =\n" + encodeHand(p)
-		}
-	}
-	game.dump()
-	game.mainloop()
 }
 
 func (game *Game) runHooks(hooks []func(*Game)) {
@@ -1280,42 +1664,104 @@ func (game *Game) runHooks(hooks []func(*Game)) {
 }
 
 func (game *Game) NewGame() {
+	if game.rng == nil {
+		game.Seed(game.seed)
+	}
 	game.data = make(map[string]interface{})
 	game.runHooks(newGameHooks)
 }
 
 func (game *Game) StartTurn(i int) {
+	game.turn++
 	game.p = game.players[i]
+	game.p.turns++
 	game.a, game.b, game.c = 1, 1, 0
 	game.discount = 0
 	game.aCount = 0
 	game.bCount = 0
+	game.phase = phAction
+	game.Report(TurnEvent{i, game.turn})
 	game.runHooks(turnHooks)
 }
 
-func (game *Game) mainloop() {
+func (game *Game) mainloop() *Result {
 	game.NewGame()
-	for i := 0; ; i = (i + 1) % len(game.players) {
-		game.StartTurn(i)
+	game.StartTurn(0)
+	return game.resume()
+}
+
+// resume plays the game from the current phase of the current turn until
+// the game ends.
+func (game *Game) resume() *Result {
+	for {
+		if r := game.run(); r != nil {
+			return r
+		}
+	}
+}
+
+// run is resume, except it returns nil if the game is rolled back by an
+// undo.
+func (game *Game) run() (r *Result) {
+	defer func() {
+		if x := recover(); x != nil {
+			if _, ok := x.(quitGame); ok {
+				// Whoever quit may not wait for listeners to show the
+				// result.
+				game.quiet = true
+				r = game.Over()
+				game.quiet = false
+				r.quit = true
+				fmt.Printf("Game over\n%v", r)
+				return
+			}
+			rb, ok := x.(rollback)
+			if !ok {
+				panic(x)
+			}
+			players := game.players
+			if err := game.restore(rb.snap, func(name string) *Player {
+				for _, p := range players {
+					if p.name == name {
+						return p
+					}
+				}
+				panic("unreachable")
+			}); err != nil {
+				panic(err)
+			}
+			r = nil
+		}
+	}()
+	for {
 		p := game.p
 		prev := phCleanup
-		for game.phase = phAction; game.phase <= phCleanup; {
+		for game.phase <= phCleanup {
 			if prev != game.phase {
-				game.Report(Event{s: "phase"})
+				game.Report(PhaseEvent{p.n, game.phase})
 				prev = game.phase
 			}
 			if game.phase == phAction && game.a == 0 || game.phase == phBuy && game.b == 0 || game.phase == phCleanup {
 				game.phase++
 				continue
 			}
-			cmd := game.getCommand(p)
+			if game.saveFile != "" {
+				if err := game.SaveFile(game.saveFile); err != nil {
+					log.Print("save: ", err)
+				}
+			}
+			game.checkpoint()
+			game.markUndo()
+			game.ask(&Decision{kind: decTop})
+			cmd := game.getCommand(p, game.checkTop)
 			switch cmd.s {
 			case "buy":
 				choice := cmd.c
 				if err := CanBuy(game, choice); err != "" {
 					panic(err)
 				}
-				fmt.Printf("%v buys %v for $%v\n", p.name, choice.name, game.Cost(choice))
+				game.Printf("%v buys %v for $%v\n", p.name, choice.name, game.Cost(choice))
+				game.Report(BuyEvent{p.n, choice})
 				game.Spend(choice)
 				game.panickyGain(p, choice)
 			case "play":
@@ -1328,85 +1774,194 @@ func (game *Game) mainloop() {
 			}
 		}
 		game.Cleanup()
-		n := 0
-		for _, c := range game.suplist {
-			if c.supply == 0 {
-				if c.name == "Province" {
-					n = 3
-					break
-				}
-				n++
-				if n == 3 {
-					break
-				}
+		if game.isOver() {
+			return game.Over()
+		}
+		game.draw(p, 5)
+		game.StartTurn((p.n + 1) % len(game.players))
+	}
+}
+
+// checkTop checks a command given when no card is being played.
+func (game *Game) checkTop(cmd Command) string {
+	switch cmd.s {
+	case "buy":
+		if cmd.c == nil {
+			return "no card"
+		}
+		return CanBuy(game, cmd.c)
+	case "play":
+		if cmd.c == nil {
+			return "no card"
+		}
+		return game.CanPlay(game.p, cmd.c)
+	case "next", "quit":
+		return ""
+	}
+	return "bad command: " + cmd.s
+}
+
+// showEvent prints ev as seen by p. A nil p sees every card drawn.
+// Events that are also described in text are not printed again.
+func showEvent(game *Game, p *Player, ev Event) {
+	switch ev := ev.(type) {
+	case TextEvent:
+		fmt.Print(ev.s)
+	case EndEvent:
+		fmt.Printf("Game over\n%v", ev.result)
+	case DiscardEvent:
+		x := game.players[ev.n]
+		if ev.deck {
+			fmt.Printf("%v discards deck; %v cards (%v)\n", x.name, ev.count, ev.top)
+		} else {
+			fmt.Printf("%v discards %v cards (%v)\n", x.name, ev.count, ev.top)
+		}
+	case GainEvent:
+		fmt.Printf("%v gains %v\n", game.players[ev.n].name, ev.card.name)
+	case TrashEvent:
+		fmt.Printf("%v trashes %v\n", game.players[ev.n].name, ev.card.name)
+	case ChatEvent:
+		fmt.Printf("<%v> %v\n", ev.from, ev.text)
+	case RefusedEvent:
+		if p != nil && p.n == ev.n {
+			fmt.Println(ev.msg)
+		}
+	case DrawEvent:
+		x := game.players[ev.n]
+		if p != nil && x != p {
+			fmt.Printf("%v draws %v cards\n", x.name, len(ev.cards))
+		} else {
+			for _, c := range ev.cards {
+				fmt.Printf("%v draws [%c] %v\n", x.name, game.keys[c], c.name)
 			}
 		}
-		if n == 3 {
-			game.Over()
+	}
+}
+
+// drainEvents passes on the events that arrived before the game stopped
+// to wait for a command, so they are shown before any prompt.
+func drainEvents(events <-chan Event, show func(Event)) {
+	for {
+		select {
+		case ev := <-events:
+			show(ev)
+		default:
 			return
 		}
-		game.draw(p, 5)
 	}
 }
 
-type consoleGamer struct{}
+// readLines returns a channel on which lines read from r arrive, closed
+// at the end of r.
+func readLines(r io.Reader) <-chan string {
+	lines := make(chan string)
+	go func() {
+		reader := bufio.NewReader(r)
+		for {
+			s, err := reader.ReadString('\n')
+			if err == io.EOF {
+				close(lines)
+				return
+			}
+			if err != nil {
+				panic(err)
+			}
+			lines <- s
+		}
+	}()
+	return lines
+}
+
+// A line typed at the console that starts with chatPrefix is said to the
+// other players, rather than read as keys.
+const chatPrefix = `"`
 
-func (consoleGamer) start(game *Game, p *Player) {
-	reader := bufio.NewReader(os.Stdin)
+// consoleGamer plays for a person at the terminal, and shows them what
+// happens in the game.
+type consoleGamer struct {
+	events <-chan Event
+}
+
+func (this consoleGamer) start(game *Game, p *Player) {
+	lines := readLines(os.Stdin)
+	var typed []string // Lines typed before they were asked for.
 	i := 0
 	prog := ""
 	wildCard := false
 	buyMode := false
+	// Set when our action phase begins, so our hand is shown before the
+	// first prompt.
+	showHand := false
+	show := func(ev Event) {
+		if ev, ok := ev.(PhaseEvent); ok && ev.n == p.n && ev.phase == phAction {
+			showHand = true
+		}
+		showEvent(game, p, ev)
+	}
+	// say sends s to the other players if it is chat, and reports whether
+	// it was.
+	say := func(s string) bool {
+		if !strings.HasPrefix(s, chatPrefix) {
+			return false
+		}
+		text := strings.TrimSpace(s[len(chatPrefix):])
+		switch {
+		case text == "":
+		case game.sendChat == nil:
+			fmt.Println("no one to chat with")
+		default:
+			if err := game.sendChat(game, p, text); err != nil {
+				fmt.Printf("chat: %v\n", err)
+			}
+		}
+		return true
+	}
+	// readLine returns the next line that is not chat. Events that arrive
+	// meanwhile, such as chat, are shown, followed by the prompt again.
+	readLine := func(prompt func()) (string, error) {
+		prompt()
+		for {
+			if len(typed) > 0 {
+				s := typed[0]
+				typed = typed[1:]
+				return s, nil
+			}
+			if lines == nil {
+				return "", io.EOF
+			}
+			select {
+			case ev := <-this.events:
+				fmt.Println()
+				show(ev)
+				prompt()
+			case s, ok := <-lines:
+				if !ok {
+					lines = nil
+				} else if !say(s) {
+					return s, nil
+				}
+			}
+		}
+	}
 	for {
 		select {
-		case ev := <-p.herald:
-			x := game.players[ev.n]
-			switch ev.s {
-			case "discard":
-				if ev.i == 0 {
-					log.Print("BUG: reported 0 discards")
-				}
-				fmt.Printf("%v discards %v cards (%v)\n", x.name, ev.i, game.GetDiscard(game, x))
-			case "discarddeck":
-				fmt.Printf("%v discards deck; %v cards (%v)\n", x.name, ev.i, game.GetDiscard(game, x))
-			case "gain":
-				fmt.Printf("%v gains %v\n", x.name, ev.card.name)
-				x.manifest = append(x.manifest, ev.card)
-			case "trash":
-				fmt.Printf("%v trashes %v\n", x.name, ev.card.name)
-				for i, c := range x.manifest {
-					if c == ev.card {
-						x.manifest = append(x.manifest[:i], x.manifest[i+1:]...)
-						break
-					}
-				}
-			case "phase":
-				if game.p == p && game.phase == phAction {
-					p.dumpHand()
-				}
-			case "draw":
-				if x != p {
-					fmt.Printf("%v draws %v cards\n", x.name, ev.i)
-				} else {
-					for i := ev.i; i > 0; i-- {
-						c := p.hand[len(p.hand)-i]
-						fmt.Printf("%v draws [%c] %v\n", p.name, c.key, c.name)
-					}
-				}
+		case ev := <-this.events:
+			show(ev)
+		case s, ok := <-lines:
+			if !ok {
+				lines = nil
+			} else if !say(s) {
+				typed = append(typed, s)
 			}
-			game.ch <- Command{s: "ack"}
 		case <-p.trigger:
+			drainEvents(this.events, show)
 			game.ch <- func() Command {
 				if game.phase == phSetup {
 					for {
-						fmt.Printf("> ")
-						s, err := reader.ReadString('\n')
+						s, err := readLine(func() { fmt.Printf("> ") })
 						if err == io.EOF {
 							panic("EOF")
 						}
-						if err != nil {
-							panic(err)
-						}
 						v := strings.SplitN(strings.TrimSpace(s), " ", 2)
 						if len(v) == 0 {
 							continue
@@ -1430,6 +1985,8 @@ func (consoleGamer) start(game *Game, p *Player) {
 									return Command{s: "preset", i: i}
 								}
 							}
+						case "random":
+							return Command{s: "random"}
 						case "start":
 							if len(game.players) == 1 {
 								fmt.Println("need at least 2 players")
@@ -1441,6 +1998,10 @@ func (consoleGamer) start(game *Game, p *Player) {
 					}
 				}
 				frame := game.StackTop()
+				if showHand {
+					showHand = false
+					game.dumpHand(p)
+				}
 				if frame == nil {
 					// Automatically advance to next phase when it's obvious.
 					if game.phase == phAction && !p.inHand((*Card).IsAction) {
@@ -1466,33 +2027,37 @@ func (consoleGamer) start(game *Game, p *Player) {
 					}
 					i++
 					for i >= len(prog) {
-						fmt.Printf("a:%v b:%v c:%v", game.a, game.b, game.c)
-						if frame != nil {
-							if frame.Prompt != "" {
-								fmt.Printf(" %v: %v ", frame.card.name, frame.Prompt)
+						s, err := readLine(func() {
+							fmt.Printf("a:%v b:%v c:%v", game.a, game.b, game.c)
+							if frame != nil {
+								if frame.Prompt != "" {
+									fmt.Printf(" %v: %v ", frame.card.name, frame.Prompt)
+								} else {
+									fmt.Printf(" %v> ", frame.card.name)
+								}
 							} else {
-								fmt.Printf(" %v> ", frame.card.name)
+								fmt.Printf("> ")
 							}
-						} else {
-							fmt.Printf("> ")
-						}
-						s, err := reader.ReadString('\n')
+						})
 						if err == io.EOF {
 							fmt.Printf("\nQuitting game...\n")
 							return Command{s: "quit"}
 						}
-						if err != nil {
-							panic(err)
-						}
 						prog, i = s, 0
 					}
+					if prog[i] == 'u' {
+						// Undo; the rest of the line was typed for
+						// the old position.
+						prog = ""
+						return Command{s: "undo"}
+					}
 					match := true
 					switch prog[i] {
 					case '\n':
 					case ' ':
 					case '?':
 						game.dump()
-						p.dumpHand()
+						game.dumpHand(p)
 					default:
 						match = false
 					}
@@ -1560,72 +2125,114 @@ func (consoleGamer) start(game *Game, p *Player) {
 	}
 }
 
-func encodeKingdom(game *Game) string {
-	s := ""
-	for _, c := range game.suplist {
-		s += fmt.Sprintf("%v,%v,%v\n", c.name, c.supply, c.key)
-	}
-	return s
-}
-
-func encodeHand(p *Player) string {
-	s := ""
-	for _, c := range p.hand {
-		s += string(c.key)
-	}
-	return s + "\n"
-}
-
-func encodePlayers(ps []*Player) string {
-	s := ""
-	for _, p := range ps {
-		s += p.name + "\n"
-	}
-	return s
+type netGamer struct {
+	in     chan Command
+	out    chan string       // Why a command was not sent, or "".
+	attach chan chan message // Streams to the client; each replaces the last.
+	rejoin chan bool         // The client has lost its copy of the game; true if it wants views.
+	views  bool              // The client has no copy of the game, and is sent views.
+	quit   chan bool         // Closed when a spectator leaves; nil for players.
+	nack   chan unsent       // Messages a stream took but could not send.
 }
 
-type netGamer struct {
-	in  chan Command
-	out chan string
+// unsent is a message taken from a stream but not sent to the client.
+type unsent struct {
+	stream chan message
+	m      message
 }
 
 func (this netGamer) start(game *Game, p *Player) {
-	var q []string
+	var q []message
+	// The client can rebuild the game from base, the game as it last saw
+	// it between commands, and the messages since.
+	var base message
+	var since []message
+	var stream chan message
+	// The last stream closed by a rejoin. What it failed to send is
+	// already in base and since.
+	var dropped chan message
 	ready := false
 	for {
+		// Send the next message once the client is listening.
+		var events chan message
+		var first message
+		if len(q) > 0 {
+			events, first = stream, q[0]
+		}
 		select {
-		case s := <-p.recv:
-			q = append(q, s)
+		case m := <-p.recv:
+			switch m.Type {
+			case "mark":
+				// Not for the client, unless it wants views.
+				base, since = message{Type: "resume", View: m.View}, nil
+				if this.views {
+					q = append(q, message{Type: "view", View: m.View})
+				}
+				continue
+			case "new", "resume":
+				base, since = m, nil
+			case "error", "token", "chat":
+			default:
+				since = append(since, m)
+			}
+			q = append(q, m)
 		case <-p.trigger:
 			if ready {
 				log.Fatal("already ready")
 			}
-			q = append(q, "go")
+			q = append(q, goMessage(game, p, this.views))
 			ready = true
-		case cmd := <-this.in:
-			switch cmd.s {
-			case "poll":
-				if len(q) == 0 {
-					if ready {
-						log.Print("extra poll")
-						this.out <- "Go!"
-					} else {
-						this.out <- "wait"
+		case events <- first:
+			q = q[1:]
+		case x := <-this.nack:
+			// Send it again on the next stream.
+			if x.stream != dropped {
+				q = append([]message{x.m}, q...)
+			}
+		case <-this.quit:
+			if stream != nil {
+				close(stream)
+			}
+			return
+		case c := <-this.attach:
+			if stream != nil {
+				close(stream)
+			}
+			stream = c
+		case this.views = <-this.rejoin:
+			// Wait for the new client to listen. Commands since base
+			// are replayed without asking anyone.
+			if stream != nil {
+				close(stream)
+				dropped, stream = stream, nil
+			}
+			q = nil
+			if base.Type != "" {
+				m := base
+				m.Redo = nil
+				for _, x := range since {
+					if x.Type == "cmd" {
+						m.Redo = append(m.Redo, *x.Cmd)
 					}
-					break
 				}
-				s := q[0]
-				q = q[1:]
-				this.out <- s
-			default:
-				if !ready {
-					log.Fatal("breach of protocol: " + cmd.s)
-				} else {
-					ready = false
-					game.ch <- cmd
-					this.out <- "sent"
+				q = append(q, m)
+			}
+			for _, x := range since {
+				if x.Type != "cmd" {
+					q = append(q, x)
 				}
 			}
+			if ready {
+				q = append(q, goMessage(game, p, this.views))
+			}
+		case cmd := <-this.in:
+			if !ready {
+				this.out <- "not your turn"
+			} else {
+				ready = false
+				game.ch <- cmd
+				this.out <- ""
+			}
 		}
 	}
 }
@@ -0,0 +1,120 @@
+package main
+
+import "testing"
+
+func TestSeedShuffle(t *testing.T) {
+	deal := func(seed int64) Pile {
+		players := Setup(t, `
+= Alice =
+discard:Copper,Copper,Copper,Estate,Silver,Gold,Estate,Duchy,Copper,Smithy
+`)
+		game := &Game{players: players}
+		game.Seed(seed)
+		game.MaybeShuffle(players[0])
+		return players[0].deck
+	}
+	if msg := ComparePiles(deal(42), deal(42)); msg != "" {
+		t.Errorf("same seed, different shuffles: %v", msg)
+	}
+}
+
+func TestRefuse(t *testing.T) {
+	players := Setup(t, `
+= Alice =
+hand:Cellar,Estate,Copper
+deck:Silver
+= Bob =
+`)
+	game := newGame()
+	game.players = players
+	game.NewGame()
+	game.StartTurn(0)
+	alice := players[0]
+	alice.recv = make(chan message, 100)
+	go game.resume()
+	refused := func() string {
+		for m := range alice.recv {
+			if m.Type == "error" {
+				return m.Error
+			}
+		}
+		return ""
+	}
+	for _, x := range []struct {
+		cmd Command
+		err string
+	}{
+		{Command{s: "buy", c: GetCard("Copper")}, "wrong phase"},
+		{Command{s: "play"}, "no card"},
+		{Command{s: "quit"}, "remote players cannot end the game"},
+		{Command{s: "undo"}, "cannot undo: only local games can be undone"},
+		{Command{s: "play", c: GetCard("Cellar")}, ""},
+		{Command{s: "pick", c: GetCard("Gold")}, "invalid choice"},
+		{Command{s: "yes"}, "bad command: yes"},
+		{Command{s: "pick", c: GetCard("Estate")}, ""},
+		{Command{s: "done"}, ""},
+	} {
+		<-alice.trigger
+		game.ch <- x.cmd
+		if x.err != "" {
+			if s := refused(); s != x.err {
+				t.Errorf("%v: want %q, got %q", x.cmd.s, x.err, s)
+			}
+		}
+	}
+	<-alice.trigger
+	CheckPiles(t, players, `
+= Alice =
+hand:Copper,Silver
+played:Cellar
+discard:Estate
+`)
+}
+
+func TestQuit(t *testing.T) {
+	players := Setup(t, `
+= Alice =
+hand:Copper
+= Bob =
+`)
+	game := newGame()
+	game.players = players
+	game.NewGame()
+	game.StartTurn(0)
+	done := make(chan *Result)
+	go func() { done <- game.resume() }()
+	<-players[0].trigger
+	game.ch <- Command{s: "quit"}
+	if r := <-done; !r.quit || len(r.players) != 2 {
+		t.Errorf("want the result of a quit game, got %+v", r)
+	}
+
+	// Quitting before the game starts.
+	game = newGame()
+	game.players = Setup(t, "= Alice =\n= Bob =\n")
+	game.seed = 1
+	go func() { done <- singleGame(game) }()
+	<-game.players[0].trigger
+	game.ch <- Command{s: "quit"}
+	if r := <-done; !r.quit {
+		t.Errorf("want a quit, got %+v", r)
+	}
+}
+
+func TestSeparateSupply(t *testing.T) {
+	deal := func(names ...string) *Game {
+		game := &Game{}
+		game.Reset()
+		for i, s := range names {
+			game.players = append(game.players, &Player{name: s, n: i})
+		}
+		game.Seed(1)
+		game.deal(presets[0])
+		return game
+	}
+	two, five := deal("Alice", "Bob"), deal("Alice", "Bob", "Carol", "Dave", "Eve")
+	province := GetCard("Province")
+	if two.supply[province] != 8 || five.supply[province] != 15 {
+		t.Errorf("Province supply: got %v and %v, want 8 and 15", two.supply[province], five.supply[province])
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MonteCarlo is a bot that decides what to play and buy by playing the
+// rest of the game out many times after each move it might make, and
+// making the move that wins most often. It knows nothing of particular
+// cards, and does not cheat: cards it cannot see are dealt at random from
+// those their owners are known to have. Other decisions, such as what to
+// discard to a Militia, are left to DefaultDecider.
+type MonteCarlo struct {
+	DefaultDecider
+	playouts int           // Playouts per decision.
+	budget   time.Duration // If positive, play out until this time is up instead.
+	rng      *rand.Rand
+}
+
+// Playouts end after this many more turns in all.
+const playoutTurns = 100
+
+func newMonteCarlo(playouts int, budget time.Duration, seed int64) MonteCarlo {
+	return MonteCarlo{playouts: playouts, budget: budget, rng: rand.New(rand.NewSource(seed))}
+}
+
+func (this MonteCarlo) start(game *Game, p *Player) { playDecider(game, p, this) }
+
+// Turn tries the moves in proportion to how promising they look so far
+// (UCB1), and makes the one tried most.
+func (this MonteCarlo) Turn(game *Game, p *Player, d *Decision) Command {
+	if c := handTreasure(game, p); c != nil {
+		return Command{s: "play", c: c}
+	}
+	moves := topMoves(game, p)
+	if len(moves) == 1 {
+		return moves[0]
+	}
+	sg, err := game.snapshot(p)
+	if err != nil {
+		panic(err)
+	}
+	wins := make([]float64, len(moves))
+	tries := make([]int, len(moves))
+	deadline := time.Now().Add(this.budget)
+	for n := 0; ; n++ {
+		if this.budget > 0 {
+			if n > 0 && time.Now().After(deadline) {
+				break
+			}
+		} else if n >= this.playouts {
+			break
+		}
+		k := ucb(wins, tries, n)
+		wins[k] += this.playout(sg, p.n, moves[k])
+		tries[k]++
+	}
+	best := 0
+	for k := range moves {
+		if tries[k] > tries[best] {
+			best = k
+		}
+	}
+	return moves[best]
+}
+
+// ucbC weighs trying neglected moves against trying good ones again.
+// Scores of moves seldom differ by much, so it is small.
+const ucbC = 0.5
+
+// ucb returns the move to try next, after n tries in all.
+func ucb(wins []float64, tries []int, n int) int {
+	best, max := 0, math.Inf(-1)
+	for k := range wins {
+		if tries[k] == 0 {
+			return k
+		}
+		v := wins[k]/float64(tries[k]) + ucbC*math.Sqrt(math.Log(float64(n))/float64(tries[k]))
+		if v > max {
+			best, max = k, v
+		}
+	}
+	return best
+}
+
+// topMoves lists the moves worth trying when no card is being played:
+// playing each Action in hand, or buying each card but Curse, and moving
+// on to the next phase.
+func topMoves(game *Game, p *Player) []Command {
+	var moves []Command
+	switch game.phase {
+	case phAction:
+		seen := make(map[*Card]bool)
+		for _, c := range p.hand {
+			if c.IsAction() && !seen[c] {
+				seen[c] = true
+				moves = append(moves, Command{s: "play", c: c})
+			}
+		}
+	case phBuy:
+		for _, c := range game.suplist {
+			if !c.HasKind(kCurse) && CanBuy(game, c) == "" {
+				moves = append(moves, Command{s: "buy", c: c})
+			}
+		}
+	}
+	return append(moves, Command{s: "next"})
+}
+
+// playout plays the game out from sg, where player n's next command is
+// cmd, and scores it from 0 to 1 for n. Most of the score is for winning,
+// or a share of it for sharing the win; the rest is for the lead over the
+// best of the others, so that there is still something to play for when
+// all is lost, or won.
+func (this MonteCarlo) playout(sg *savedGame, n int, cmd Command) float64 {
+	game := newGame()
+	game.noUndo = true
+	game.maxTurns = sg.Turn + playoutTurns
+	if err := game.restore(this.deal(sg), func(string) *Player {
+		return &Player{trigger: make(chan bool)}
+	}); err != nil {
+		panic(err)
+	}
+	game.Seed(this.rng.Int63())
+	quit := make(chan bool)
+	defer close(quit)
+	for _, p := range game.players {
+		d := &playoutDecider{rng: rand.New(rand.NewSource(this.rng.Int63()))}
+		if p.n == n {
+			d.first = &cmd
+		}
+		go playDeciderUntil(game, p, d, quit)
+	}
+	r := game.resume()
+	score := 0.0
+	if r.players[n].place == 1 {
+		score = 0.8 / float64(len(r.Winners()))
+	}
+	lead := math.MaxInt32
+	for k, x := range r.players {
+		if k != n && r.players[n].score-x.score < lead {
+			lead = r.players[n].score - x.score
+		}
+	}
+	return score + 0.2/(1+math.Exp(-float64(lead)/8))
+}
+
+// deal returns a copy of sg in which each unknown card is dealt at random
+// from those its owner has that are not seen elsewhere.
+func (this MonteCarlo) deal(sg *savedGame) *savedGame {
+	g := *sg
+	g.Data = make(map[string]savedValue)
+	for key, v := range sg.Data {
+		v.Pile = append([]string(nil), v.Pile...)
+		var list []savedDuration
+		for _, d := range v.Durations {
+			list = append(list, savedDuration{d.Card, append([]string(nil), d.Set...)})
+		}
+		v.Durations = list
+		g.Data[key] = v
+	}
+	g.Players = nil
+	for _, sp := range sg.Players {
+		sp.Deck = append([]string(nil), sp.Deck...)
+		sp.Hand = append([]string(nil), sp.Hand...)
+		sp.Discard = append([]string(nil), sp.Discard...)
+		unseen := make(map[string]int)
+		for _, s := range sp.Manifest {
+			unseen[s]++
+		}
+		var slots []*string
+		see := func(names []string) {
+			for i, s := range names {
+				if s == "?" {
+					slots = append(slots, &names[i])
+				} else {
+					unseen[s]--
+				}
+			}
+		}
+		see(sp.Deck)
+		see(sp.Hand)
+		see(sp.Played)
+		see(sp.Discard)
+		for key, v := range g.Data {
+			for _, prefix := range privateData {
+				if key == prefix+sp.Name {
+					see(v.Pile)
+					for _, d := range v.Durations {
+						see(d.Set)
+					}
+				}
+			}
+		}
+		var pool []string
+		for _, s := range sp.Manifest {
+			if unseen[s] > 0 {
+				unseen[s]--
+				pool = append(pool, s)
+			}
+		}
+		this.rng.Shuffle(len(pool), func(i, j int) { pool[i], pool[j] = pool[j], pool[i] })
+		for k, s := range slots {
+			if k < len(pool) {
+				*s = pool[k]
+			} else {
+				*s = "Copper"
+			}
+		}
+		g.Players = append(g.Players, sp)
+	}
+	return &g
+}
+
+// playoutDecider plays quickly and somewhat at random. It plays a random
+// Action. It buys the costliest Victory card in the supply if it can,
+// otherwise the costliest card but Victory cards, or once that pile runs
+// low, the costliest card of any kind. Now and then it buys at random.
+type playoutDecider struct {
+	DefaultDecider
+	rng   *rand.Rand
+	first *Command // If not nil, the next command.
+}
+
+func (d *playoutDecider) Turn(game *Game, p *Player, dec *Decision) Command {
+	if d.first != nil {
+		cmd := *d.first
+		d.first = nil
+		return cmd
+	}
+	if c := handTreasure(game, p); c != nil {
+		return Command{s: "play", c: c}
+	}
+	moves := topMoves(game, p)
+	if game.phase == phAction || len(moves) == 1 || d.rng.Intn(8) == 0 {
+		return moves[d.rng.Intn(len(moves))]
+	}
+	top, late := topVictory(game), lateGame(game)
+	var best []Command
+	for _, cmd := range moves[:len(moves)-1] {
+		c := cmd.c
+		if c.IsVictory() && c != top && !late {
+			continue
+		}
+		if len(best) > 0 && game.Cost(c) < game.Cost(best[0].c) {
+			continue
+		}
+		if len(best) > 0 && game.Cost(c) > game.Cost(best[0].c) {
+			best = nil
+		}
+		best = append(best, cmd)
+	}
+	if len(best) == 0 || game.Cost(best[0].c) < 3 && !late {
+		return Command{s: "next"}
+	}
+	return best[d.rng.Intn(len(best))]
+}
+
+// parseMonteCarlo returns the MonteCarlo bot described by spec:
+// "montecarlo", optionally followed by a colon and a number of playouts
+// or a duration such as "500ms". Its playouts are drawn from seed.
+func parseMonteCarlo(spec string, seed int64) (MonteCarlo, bool, error) {
+	v := strings.SplitN(spec, ":", 2)
+	if !strings.EqualFold(v[0], "montecarlo") {
+		return MonteCarlo{}, false, nil
+	}
+	if len(v) == 1 {
+		return newMonteCarlo(400, 0, seed), true, nil
+	}
+	if n, err := strconv.Atoi(v[1]); err == nil && n > 0 {
+		return newMonteCarlo(n, 0, seed), true, nil
+	}
+	budget, err := time.ParseDuration(v[1])
+	if err != nil || budget <= 0 {
+		return MonteCarlo{}, true, fmt.Errorf("bad playouts or time: %q", v[1])
+	}
+	return newMonteCarlo(0, budget, seed), true, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestMonteCarlo(t *testing.T) {
+	game, bots, err := newSim([]string{"Province,Gold,Silver", "Province,Gold,Silver"}, 400, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	game.players = bots
+	for k, p := range bots {
+		p.n = k
+	}
+	game.Reset()
+	game.Seed(1)
+	game.deal(*findPreset("First Game"))
+	game.NewGame()
+	game.StartTurn(0)
+	province := GetCard("Province")
+	game.supply[province] = 1
+	game.phase, game.c = phBuy, 8
+	p := bots[0]
+	p.discard, p.hand = append(p.discard, p.hand...), nil
+	mc := newMonteCarlo(50, 0, 1)
+	// Buying the last Province wins.
+	if cmd := mc.Turn(game, p, &Decision{kind: decTop}); cmd.s != "buy" || cmd.c != province {
+		t.Errorf("got %v %v, want buy Province", cmd.s, cmd.c)
+	}
+	sg, err := game.snapshot(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sp := range mc.deal(sg).Players {
+		var all []string
+		for _, v := range [][]string{sp.Deck, sp.Hand, sp.Played, sp.Discard} {
+			all = append(all, v...)
+		}
+		sort.Strings(all)
+		sort.Strings(sp.Manifest)
+		if fmt.Sprint(all) != fmt.Sprint(sp.Manifest) {
+			t.Errorf("%v: dealt %v, has %v", sp.Name, all, sp.Manifest)
+		}
+	}
+}
+
+func TestMonteCarloSeed(t *testing.T) {
+	play := func() string {
+		game, bots, err := newSim([]string{"montecarlo:40", "Province,Gold,Silver"}, 12, rand.New(rand.NewSource(3)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rec bytes.Buffer
+		game.rec = &rec
+		simGame(game, bots, findPreset("First Game"), 5)
+		return rec.String()
+	}
+	if a, b := play(), play(); a != b {
+		t.Errorf("same seeds, different games:\n%v\n%v", a, b)
+	}
+}
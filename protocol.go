@@ -0,0 +1,317 @@
+package main
+
+// The wire protocol between server and clients, version 1.
+//
+// Every message is a JSON object. Fields that are zero are omitted.
+// Cards are named, as in "Copper"; a card the receiver may not see is
+// named "?".
+//
+// A client joins by POSTing a hello to /reg:
+//
+//	{"Version": 1, "Name": "Alice", "Table": 3}
+//
+// Table 0 opens a new table, at which the client sits first and says
+// when to start. The server answers with a reply:
+//
+//	{"Version": 1, "Table": 3, "Token": "9f86d081884c7d65"}
+//
+// or, if the versions differ or the seat is taken, {"Version": 1,
+// "Error": "..."}. The token is a secret. Every later request names the
+// seat and presents its token in the query string, as in
+// ?table=3&id=Alice&token=9f86d081884c7d65, and is refused if the token
+// is not that of the seat. Tokens expire when a game ends: the client is
+// sent a new one for the next game at the table.
+//
+// A client that has lost its copy of the game, say because it died,
+// POSTs a hello with its token to /reconnect:
+//
+//	{"Version": 1, "Name": "Alice", "Table": 3, "Token": "9f86d081884c7d65"}
+//
+// The reply is as for /reg, with a new token. The next stream the client
+// opens starts with a "new" or "resume" message from which to rebuild
+// the game, followed by the messages since. A newer stream for a seat
+// ends the older ones.
+//
+// A spectator POSTs a hello naming only the table to /watch, and is
+// replied a token as for /reg. Later requests of a spectator present the
+// token without an id, as in ?table=3&token=9f86d081884c7d65. Spectators
+// are sent what players see of each other, never a hand or a draw. They
+// cannot send commands. One who joins mid-game is sent "resume" before
+// the next top-level command, and leaves when their stream ends.
+//
+// GET /events streams the messages for a seat, in order, as server-sent
+// events whose data is one message each:
+//
+//	go          The server waits for a command from this client.
+//	error       The last command was refused, for the reason in Error.
+//	            The client is sent "go" again.
+//	new         A game starts: Players lists the players in turn order,
+//	            Supply the piles as in a save file, and Hand the hand
+//	            of this client.
+//	resume      The game resumes, from a save or after a reconnect:
+//	            View is the game as this client may see it, as in a
+//	            save file.
+//	cmd         Cmd is a command of the player whose turn it is to
+//	            decide, including this client.
+//	draw        Cards are those the player drew.
+//	reveal      Cards holds the card revealed from the top of a deck.
+//	revealHand  Cards holds a card revealed from a hand, one message per
+//	            card.
+//	peek        Cards holds the card the player looks at.
+//	library     Yes is true if the player must be asked about the card
+//	            drawn to Library.
+//	library2    Cards holds the card set aside by Library.
+//	max         N is the most cards that can be picked. If Forced, N of
+//	            the card in Cards are picked without asking.
+//	inhand      Yes is true if the player has a card the rules ask for.
+//	token       The game has ended. Token replaces the session token.
+//	chat        From said Text. Chat can come at any time, and has no
+//	            place in the game.
+//
+// After a reconnect, "new" and "resume" may hold Redo, the commands made
+// since, which are to be replayed in order without asking anyone. Their
+// "cmd" messages are not sent again.
+//
+// A client sends a command by POSTing it to /cmd when it has been sent
+// "go":
+//
+//	{"Cmd": "buy", "Card": "Silver"}
+//
+// The reply is {} if the command was accepted for checking, and has an
+// Error otherwise. A player says something to everyone at the table by
+// POSTing it to /chat, at any time:
+//
+//	{"Text": "good game"}
+//
+// The reply is {}, or has an Error if the text is empty, too long, or
+// holds control characters. GET /discard?n=1 replies with the top card of the
+// discard pile of player 1 in Card.
+//
+// A client that does not run its own copy of the game, such as the page
+// the server serves at /, sets Views in its hello. It is then sent the
+// game as it may see it in View at every "go", and in a "view" message
+// between commands. A "go" in a game also holds Costs, the cost of each
+// pile of the supply, and Ask, what is being asked:
+//
+//	{"Kind": "split", "Card": "Cellar", "Prompt": "pick>",
+//	 "Options": ["Estate", "Copper"], "N": 2}
+//
+// Kind is one of
+//
+//	setup   Say "preset" with N indexing Names, "random" for a random
+//	        kingdom, or "start".
+//	top     Say "play" with one of Options, "buy" with a Card, or
+//	        "next".
+//	split   Say "pick" with one of Options, until N are picked or
+//	        "done". If Exact, all N must be picked.
+//	supply  Say "pick" with one of Options, or with no card if Optional.
+//	bool    Say "yes" or "done", about Shown if any.
+//	choose  Say "1", "2" and so on up to N times, for Names.
+//
+// Card is the card being played, if any.
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+const protocolVersion = 1
+
+// hello is sent by a client to join a table.
+type hello struct {
+	Version int
+	Name    string
+	Table   int    // 0 for a new table.
+	Token   string `json:",omitempty"` // To reconnect.
+	Views   bool   `json:",omitempty"` // Send views rather than moves.
+}
+
+// reply answers a request to the server.
+type reply struct {
+	Version int    `json:",omitempty"`
+	Table   int    `json:",omitempty"`
+	Token   string `json:",omitempty"`
+	Card    string `json:",omitempty"`
+	Error   string `json:",omitempty"`
+}
+
+// wireCommand is a Command as sent over the wire.
+type wireCommand struct {
+	Cmd  string
+	Card string `json:",omitempty"`
+	N    int    `json:",omitempty"`
+}
+
+// message is sent by the server to a client.
+type message struct {
+	Type    string
+	Cards   []string       `json:",omitempty"`
+	N       int            `json:",omitempty"`
+	Yes     bool           `json:",omitempty"`
+	Forced  bool           `json:",omitempty"`
+	Cmd     *wireCommand   `json:",omitempty"`
+	Error   string         `json:",omitempty"`
+	Players []string       `json:",omitempty"`
+	Supply  []savedSupply  `json:",omitempty"`
+	Hand    []string       `json:",omitempty"`
+	View    *savedGame     `json:",omitempty"`
+	Token   string         `json:",omitempty"`
+	Redo    []wireCommand  `json:",omitempty"`
+	From    string         `json:",omitempty"`
+	Text    string         `json:",omitempty"`
+	Ask     *wireAsk       `json:",omitempty"`
+	Costs   map[string]int `json:",omitempty"`
+}
+
+// wireAsk describes a decision for a client that sets Views.
+type wireAsk struct {
+	Kind     string
+	Card     string   `json:",omitempty"`
+	Prompt   string   `json:",omitempty"`
+	Options  []string `json:",omitempty"`
+	N        int      `json:",omitempty"`
+	Exact    bool     `json:",omitempty"`
+	Optional bool     `json:",omitempty"`
+	Names    []string `json:",omitempty"`
+	Shown    []string `json:",omitempty"`
+}
+
+// chatLine is sent by a client to say something.
+type chatLine struct {
+	Text string
+}
+
+// The most runes a chat line may hold.
+const maxChat = 200
+
+// cardMessage returns a message of the given type holding cards. A nil
+// card is sent as "?".
+func cardMessage(typ string, cards ...*Card) message {
+	return message{Type: typ, Cards: pileNames(cards, false)}
+}
+
+// pile returns the cards of m, with nil for those not shown.
+func (m message) pile() Pile {
+	pile, err := namesPile(m.Cards)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return pile
+}
+
+// card returns the only card of m.
+func (m message) card() *Card {
+	if len(m.Cards) != 1 {
+		log.Fatalf("%v: want 1 card, got %v", m.Type, len(m.Cards))
+	}
+	return m.pile()[0]
+}
+
+// newGameMessage returns the message telling p that a game starts.
+func newGameMessage(game *Game, p *Player) message {
+	m := message{Type: "new", Hand: pileNames(p.hand, false)}
+	for _, x := range game.players {
+		m.Players = append(m.Players, x.name)
+	}
+	for _, c := range game.suplist {
+		m.Supply = append(m.Supply, savedSupply{c.name, game.supply[c], string(game.keys[c])})
+	}
+	return m
+}
+
+// goMessage returns the message telling p the server waits for a
+// command. If views, it also holds what p sees and is asked. It must be
+// called while the game waits for p.
+func goMessage(game *Game, p *Player, views bool) message {
+	m := message{Type: "go"}
+	if !views {
+		return m
+	}
+	sg, err := game.state(p)
+	if err != nil {
+		log.Print(err)
+	}
+	m.View = sg
+	if game.phase == phSetup {
+		m.Ask = &wireAsk{Kind: "setup"}
+		for _, pr := range presets {
+			m.Ask.Names = append(m.Ask.Names, pr.name)
+		}
+		return m
+	}
+	m.Costs = make(map[string]int)
+	for _, c := range game.suplist {
+		m.Costs[c.name] = game.Cost(c)
+	}
+	d := game.decision
+	if d == nil {
+		return m
+	}
+	kinds := [...]string{decTop: "top", decSplit: "split", decSupply: "supply", decBool: "bool", decChoose: "choose"}
+	m.Ask = &wireAsk{
+		Kind:     kinds[d.kind],
+		Prompt:   d.prompt,
+		Options:  pileNames(d.options, false),
+		N:        d.n,
+		Exact:    d.exact,
+		Optional: d.optional,
+		Names:    d.names,
+		Shown:    pileNames(d.shown, false),
+	}
+	if d.kind == decTop {
+		for _, c := range p.hand {
+			if game.CanPlay(p, c) == "" {
+				m.Ask.Options = append(m.Ask.Options, c.name)
+			}
+		}
+	}
+	if d.card != nil {
+		m.Ask.Card = d.card.name
+	}
+	if frame := game.StackTop(); frame != nil && frame.Prompt != "" {
+		m.Ask.Prompt = frame.Prompt
+	}
+	return m
+}
+
+func encodeCommand(cmd Command) *wireCommand {
+	wc := &wireCommand{Cmd: cmd.s, N: cmd.i}
+	if cmd.c != nil {
+		wc.Card = cmd.c.name
+	}
+	return wc
+}
+
+func decodeCommand(wc *wireCommand) (Command, error) {
+	cmd := Command{s: wc.Cmd, i: wc.N}
+	if wc.Card != "" {
+		var ok bool
+		if cmd.c, ok = CardDict[wc.Card]; !ok {
+			return cmd, errors.New("no such card")
+		}
+	}
+	return cmd, nil
+}
+
+// decodeRedo returns the commands to replay after a reconnect.
+func decodeRedo(redo []wireCommand) []Command {
+	var cmds []Command
+	for i := range redo {
+		cmd, err := decodeCommand(&redo[i])
+		if err != nil {
+			log.Fatal("bad command: ", err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds
+}
+
+// writeReply sends rep as the answer to a request.
+func writeReply(w http.ResponseWriter, rep reply) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rep); err != nil {
+		log.Print(err)
+	}
+}
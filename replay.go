@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A game record holds one entry per line. Fields are separated by
+// semicolons, as in messages to clients:
+//
+//	seed;<seed>
+//	preset;<preset name>
+//	kingdom;<card>,<card>,...
+//	player;<name>
+//	shuffle;<card>,<card>,...
+//	cmd;<player number>;<command>;<number>;<card>
+//
+// The header (seed, preset and players) is written when the game starts.
+// The kingdom is written only for a random one.
+// After that, every shuffle and every Command received by getCommand is
+// written as it happens.
+func (game *Game) record(kind string, vs ...interface{}) {
+	if game.rec == nil {
+		return
+	}
+	s := kind
+	for _, v := range vs {
+		switch t := v.(type) {
+		default:
+			s += fmt.Sprintf(";%v", t)
+		case *Card:
+			if t != nil {
+				s += ";" + t.name
+			} else {
+				s += ";"
+			}
+		case Pile:
+			var names []string
+			for _, c := range t {
+				names = append(names, c.name)
+			}
+			s += ";" + strings.Join(names, ",")
+		}
+	}
+	if _, err := fmt.Fprintln(game.rec, s); err != nil {
+		log.Fatal("record: ", err)
+	}
+}
+
+// Replay feeds a recorded game back into the engine.
+type Replay struct {
+	lines []string
+	stop  int // Turn at which to stop; 0 means play to the end.
+}
+
+// next returns the fields of the next entry, which must be of the given kind.
+func (r *Replay) next(kind string) []string {
+	if len(r.lines) == 0 {
+		log.Fatalf("replay: want %q, got end of record", kind)
+	}
+	v := strings.Split(r.lines[0], ";")
+	if v[0] != kind {
+		log.Fatalf("replay diverged: want %q, got %q", kind, r.lines[0])
+	}
+	r.lines = r.lines[1:]
+	return v
+}
+
+func (r *Replay) peek() string {
+	if len(r.lines) == 0 {
+		return ""
+	}
+	return strings.SplitN(r.lines[0], ";", 2)[0]
+}
+
+// shuffle puts deck in the recorded order.
+func (r *Replay) shuffle(deck Pile) {
+	v := r.next("shuffle")
+	names := strings.Split(v[1], ",")
+	if len(deck) == 0 && v[1] == "" {
+		return
+	}
+	if len(names) != len(deck) {
+		log.Fatalf("replay diverged: shuffling %v cards, record has %v", len(deck), len(names))
+	}
+	for i, s := range names {
+		deck[i] = GetCard(s)
+	}
+}
+
+func (r *Replay) command(p *Player) Command {
+	v := r.next("cmd")
+	if len(v) != 5 {
+		log.Fatalf("replay: malformed command %q", strings.Join(v, ";"))
+	}
+	if PanickyAtoi(v[1]) != p.n {
+		log.Fatalf("replay diverged: want command from player %v, got %v", p.n, v[1])
+	}
+	cmd := Command{s: v[2], i: PanickyAtoi(v[3])}
+	if v[4] != "" {
+		cmd.c = GetCard(v[4])
+	}
+	return cmd
+}
+
+// replayGamer sends the recorded commands of a player.
+type replayGamer struct {
+	r      *Replay
+	events <-chan Event // Events to print, if any.
+	done   chan bool    // Closed once the end of the game is printed.
+}
+
+func (this replayGamer) start(game *Game, p *Player) {
+	turn := 0
+	show := func(ev Event) {
+		showEvent(game, nil, ev)
+		if _, ok := ev.(EndEvent); ok {
+			close(this.done)
+		}
+	}
+	for {
+		select {
+		case ev := <-this.events:
+			show(ev)
+		case <-p.trigger:
+			drainEvents(this.events, show)
+			if game.turn != turn {
+				turn = game.turn
+				if this.r.stop > 0 && turn >= this.r.stop {
+					fmt.Printf("Stopped at turn %v\n", turn)
+					game.dump()
+					for _, x := range game.players {
+						fmt.Printf("= %v =\n", x.name)
+						game.dumpHand(x)
+					}
+					os.Exit(0)
+				}
+				fmt.Printf("= Turn %v: %v =\n", turn, game.p.name)
+			}
+			game.ch <- this.r.command(p)
+		}
+	}
+}
+
+// recordHeader records the seed, kingdom and players of a game about to
+// be dealt.
+func (game *Game) recordHeader(pr Preset) {
+	game.record("seed", game.seed)
+	game.record("preset", pr.name)
+	if findPreset(pr.name) == nil {
+		game.record("kingdom", pr.cards)
+	}
+	for _, p := range game.players {
+		game.record("player", p.name)
+	}
+}
+
+// replayGame sets up a game from the record in b, with a replayGamer in
+// each seat, and returns it with its kingdom, ready to be dealt.
+func replayGame(b []byte, stop int) (*Game, *Preset) {
+	r := &Replay{lines: strings.Split(strings.TrimSpace(string(b)), "\n"), stop: stop}
+	game := newGame()
+	game.replay = r
+	seed, err := strconv.ParseInt(r.next("seed")[1], 10, 64)
+	if err != nil {
+		log.Fatal("replay: bad seed: ", err)
+	}
+	game.Reset()
+	game.Seed(seed)
+	name := r.next("preset")[1]
+	pr := findPreset(name)
+	if r.peek() == "kingdom" {
+		cards, err := namesPile(strings.Split(r.next("kingdom")[1], ","))
+		if err != nil {
+			log.Fatal("replay: ", err)
+		}
+		pr = &Preset{name: name, cards: cards}
+	}
+	if pr == nil {
+		log.Fatalf("replay: no such preset: %q", name)
+	}
+	for r.peek() == "player" {
+		p := &Player{name: r.next("player")[1], n: len(game.players), fun: replayGamer{r: r}}
+		p.trigger = make(chan bool)
+		game.players = append(game.players, p)
+	}
+	if len(game.players) == 0 {
+		log.Fatal("replay: no players")
+	}
+	return game, pr
+}
+
+func replay(filename string, stop int) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	game, pr := replayGame(b, stop)
+	fmt.Printf("Seed: %v\n", game.seed)
+	fmt.Printf("Playing %q\n", pr.name)
+	// One listener suffices to print every event.
+	done := make(chan bool)
+	game.players[0].fun = replayGamer{game.replay, game.Subscribe(), done}
+	for _, p := range game.players {
+		go p.fun.start(game, p)
+	}
+	game.deal(*pr)
+	game.dump()
+	game.mainloop()
+	<-done
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	game, bots, err := newSim([]string{"heuristic:Militia,Province,Gold,Silver", "heuristic:Smithy,Cellar,Province,Gold,Silver"}, 400, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec bytes.Buffer
+	game.rec = &rec
+	want := simGame(game, bots, findPreset("First Game"), 11)
+	game.rec = nil
+	replayed, pr := replayGame(rec.Bytes(), 0)
+	for _, p := range replayed.players {
+		go p.fun.start(replayed, p)
+	}
+	replayed.deal(*pr)
+	got := replayed.mainloop()
+	if got.String() != want.String() {
+		t.Errorf("want result\n%v\ngot\n%v", want, got)
+	}
+	state := func(g *Game) string {
+		sg, err := g.snapshot(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := json.Marshal(sg)
+		return string(b)
+	}
+	if a, b := state(game), state(replayed); a != b {
+		t.Errorf("want final state\n%v\ngot\n%v", a, b)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Result is the outcome of a game.
+type Result struct {
+	players []PlayerResult // In seating order.
+	quit    bool           // A local player ended the game early.
+}
+
+type PlayerResult struct {
+	name  string
+	score int
+	turns int
+	place int // 1 for the winners; players who tie share a place.
+	vp    []CardVP
+}
+
+// CardVP is what the copies of one card were worth to a player.
+type CardVP struct {
+	card      *Card
+	count, vp int
+}
+
+// Winners returns the names of the players who came first.
+func (r *Result) Winners() []string {
+	var names []string
+	for _, x := range r.players {
+		if x.place == 1 {
+			names = append(names, x.name)
+		}
+	}
+	return names
+}
+
+func (r *Result) String() string {
+	s := ""
+	for _, x := range r.players {
+		s += fmt.Sprintf("%v: %v (%v turns, place %v)\n", x.name, x.score, x.turns, x.place)
+		for _, v := range x.vp {
+			s += fmt.Sprintf("%v x %v = %v\n", v.count, v.card.name, v.vp)
+		}
+	}
+	w := r.Winners()
+	if len(w) == 1 {
+		s += "Winner: " + w[0] + "\n"
+	} else {
+		s += "Shared win: " + strings.Join(w, ", ") + "\n"
+	}
+	return s
+}
+
+// rank places the players. The higher score wins; on a tie, so does the
+// player who had fewer turns. Players who are still tied share a place.
+func (r *Result) rank() {
+	order := make([]int, len(r.players))
+	for i := range order {
+		order[i] = i
+	}
+	beats := func(a, b PlayerResult) bool {
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		return a.turns < b.turns
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return beats(r.players[order[i]], r.players[order[j]])
+	})
+	for k, i := range order {
+		x := &r.players[i]
+		x.place = k + 1
+		if k > 0 {
+			prev := r.players[order[k-1]]
+			if !beats(prev, *x) {
+				x.place = prev.place
+			}
+		}
+	}
+}
+
+// isOver reports whether the game has ended: the Provinces are gone, or
+// enough other supply piles are empty, or time is up.
+func (game *Game) isOver() bool {
+	if game.maxTurns > 0 && game.turn >= game.maxTurns {
+		return true
+	}
+	piles := 3
+	if len(game.players) > 4 {
+		piles = 4
+	}
+	n := 0
+	for _, c := range game.suplist {
+		if game.supply[c] == 0 {
+			if c.name == "Province" {
+				return true
+			}
+			n++
+		}
+	}
+	return n >= piles
+}
+
+// Over scores the game, and reports and returns the result.
+func (game *Game) Over() *Result {
+	game.runHooks(endGameHooks)
+	r := &Result{}
+	for _, p := range game.players {
+		game.p = p // Require current player for some VP computations.
+		x := PlayerResult{name: p.name, turns: p.turns}
+		m := make(map[*Card]*CardVP)
+		// Show cards in the supply even if p has none of them.
+		for _, c := range game.suplist {
+			if c.IsVictory() || c.HasKind(kCurse) {
+				x.vp = append(x.vp, CardVP{card: c})
+			}
+		}
+		for i := range x.vp {
+			m[x.vp[i].card] = &x.vp[i]
+		}
+		var extra []*CardVP
+		for _, c := range p.manifest {
+			if c.IsVictory() || c.HasKind(kCurse) {
+				if c.vp == nil {
+					game.Printf("%v unimplemented  :(\n", c.name)
+					continue
+				}
+				v, ok := m[c]
+				if !ok {
+					v = &CardVP{card: c}
+					m[c] = v
+					extra = append(extra, v)
+				}
+				n := c.vp(game)
+				v.count++
+				v.vp += n
+				x.score += n
+			}
+		}
+		for _, v := range extra {
+			x.vp = append(x.vp, *v)
+		}
+		r.players = append(r.players, x)
+	}
+	r.rank()
+	game.Report(EndEvent{r})
+	return r
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestResult(t *testing.T) {
+	players := Setup(t, `
+= Alice =
+hand:Province,Estate
+= Bob =
+hand:Province,Estate
+= Carol =
+hand:Duchy,Duchy,Curse
+`)
+	for _, p := range players {
+		p.manifest = append(Pile{}, p.hand...)
+	}
+	players[0].turns, players[1].turns, players[2].turns = 10, 9, 9
+	game := &Game{players: players}
+	game.NewGame()
+	game.suplist = ParsePile("Estate,Duchy,Province,Curse")
+	r := game.Over()
+	for i, want := range []struct{ score, place int }{{7, 2}, {7, 1}, {5, 3}} {
+		if x := r.players[i]; x.score != want.score || x.place != want.place {
+			t.Errorf("%v: got score %v place %v, want %v", x.name, x.score, x.place, want)
+		}
+	}
+	if w := r.Winners(); len(w) != 1 || w[0] != "Bob" {
+		t.Errorf("winners: got %v, want Bob", w)
+	}
+	players[0].turns = 9
+	if w := game.Over().Winners(); len(w) != 2 {
+		t.Errorf("winners: got %v, want Alice and Bob", w)
+	}
+}
+
+func TestIsOver(t *testing.T) {
+	game := &Game{players: make([]*Player, 5)}
+	game.suplist = ParsePile("Copper,Silver,Gold,Estate,Province")
+	game.supply = map[*Card]int{GetCard("Province"): 1, GetCard("Estate"): 1}
+	if game.isOver() {
+		t.Error("5 players: over with 3 empty piles")
+	}
+	game.supply[GetCard("Estate")] = 0
+	if !game.isOver() {
+		t.Error("5 players: not over with 4 empty piles")
+	}
+	game.players = game.players[:4]
+	game.supply[GetCard("Estate")] = 1
+	if !game.isOver() {
+		t.Error("4 players: not over with 3 empty piles")
+	}
+}
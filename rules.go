@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Buy rules tell SimpleBuyer what to buy. Rules are separated by newlines
+// or commas, and the first rule that holds for a card the bot can afford
+// decides the buy. A rule is a card name, optionally followed by "if" and
+// conditions joined by "and":
+//
+//	# Big Money Ultimate, more or less.
+//	Province if total money in deck >= 16
+//	Duchy if Provinces left <= 4
+//	Estate if Provinces left <= 2
+//	Smithy if count(Smithy) < 1
+//	Gold
+//	Silver
+//
+// A condition compares two numbers with one of < <= > >= == !=. A number
+// is an integer or one of:
+//
+//	money, total money in deck  coins produced by all treasures owned
+//	cards                       number of cards owned
+//	count(Card)                 copies of Card owned
+//	left(Card), Cards left      copies of Card in the supply
+//	turn                        turns taken by the player so far
+//	coins                       coins available to spend
+//
+// Text from # to the end of a line is ignored.
+
+// A BuyRule says to buy a card if its conditions hold.
+type BuyRule struct {
+	card  *Card
+	conds []buyCond
+}
+
+type buyCond struct {
+	a, b buyTerm
+	op   string
+}
+
+// buyTerm is a number that depends on the state of the game.
+type buyTerm func(game *Game, p *Player) int
+
+func (r BuyRule) holds(game *Game, p *Player) bool {
+	for _, c := range r.conds {
+		a, b := c.a(game, p), c.b(game, p)
+		var ok bool
+		switch c.op {
+		case "<":
+			ok = a < b
+		case "<=":
+			ok = a <= b
+		case ">":
+			ok = a > b
+		case ">=":
+			ok = a >= b
+		case "==":
+			ok = a == b
+		case "!=":
+			ok = a != b
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseRules reads buy rules from text.
+func ParseRules(text string) ([]BuyRule, error) {
+	var rules []BuyRule
+	for n, line := range strings.Split(text, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		for _, s := range strings.Split(line, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			r, err := parseRule(s)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %v", n+1, err)
+			}
+			rules = append(rules, r)
+		}
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("no rules")
+	}
+	return rules, nil
+}
+
+// LoadRules reads buy rules from the named file.
+func LoadRules(filename string) ([]BuyRule, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(string(b))
+}
+
+func parseRule(s string) (BuyRule, error) {
+	var r BuyRule
+	v := strings.SplitN(s, " if ", 2)
+	r.card = findCard(strings.TrimSpace(v[0]))
+	if r.card == nil {
+		return r, fmt.Errorf("no such card: %q", v[0])
+	}
+	if len(v) == 1 {
+		return r, nil
+	}
+	for _, s := range strings.Split(v[1], " and ") {
+		c, err := parseCond(strings.TrimSpace(s))
+		if err != nil {
+			return r, err
+		}
+		r.conds = append(r.conds, c)
+	}
+	return r, nil
+}
+
+func parseCond(s string) (buyCond, error) {
+	var c buyCond
+	for _, op := range []string{"<=", ">=", "==", "!=", "<", ">"} {
+		if i := strings.Index(s, op); i >= 0 {
+			var err error
+			c.op = op
+			if c.a, err = parseTerm(strings.TrimSpace(s[:i])); err != nil {
+				return c, err
+			}
+			if c.b, err = parseTerm(strings.TrimSpace(s[i+len(op):])); err != nil {
+				return c, err
+			}
+			return c, nil
+		}
+	}
+	return c, fmt.Errorf("no comparison in %q", s)
+}
+
+func parseTerm(s string) (buyTerm, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return func(*Game, *Player) int { return n }, nil
+	}
+	switch s {
+	case "money", "total money in deck":
+		return func(game *Game, p *Player) int {
+			n := 0
+			for _, c := range p.manifest {
+				if c.IsTreasure() {
+					n += c.coin
+				}
+			}
+			return n
+		}, nil
+	case "cards":
+		return func(game *Game, p *Player) int { return len(p.manifest) }, nil
+	case "turn":
+		return func(game *Game, p *Player) int { return p.turns }, nil
+	case "coins":
+		return func(game *Game, p *Player) int { return game.c }, nil
+	}
+	arg := func(fn string) string {
+		if strings.HasPrefix(s, fn+"(") && strings.HasSuffix(s, ")") {
+			return strings.TrimSpace(s[len(fn)+1 : len(s)-1])
+		}
+		return ""
+	}
+	card := func(name string) (*Card, error) {
+		c := findCard(name)
+		if c == nil {
+			return nil, fmt.Errorf("no such card: %q", name)
+		}
+		return c, nil
+	}
+	left := func(c *Card) buyTerm {
+		return func(game *Game, p *Player) int { return game.supply[c] }
+	}
+	if name := arg("count"); name != "" {
+		c, err := card(name)
+		if err != nil {
+			return nil, err
+		}
+		return func(game *Game, p *Player) int {
+			n := 0
+			for _, x := range p.manifest {
+				if x == c {
+					n++
+				}
+			}
+			return n
+		}, nil
+	}
+	if name := arg("left"); name != "" {
+		c, err := card(name)
+		if err != nil {
+			return nil, err
+		}
+		return left(c), nil
+	}
+	if strings.HasSuffix(s, " left") {
+		c, err := card(strings.TrimSpace(strings.TrimSuffix(s, " left")))
+		if err != nil {
+			return nil, err
+		}
+		return left(c), nil
+	}
+	return nil, fmt.Errorf("unknown number: %q", s)
+}
+
+// findCard returns the card with the given name, which may be plural.
+func findCard(name string) *Card {
+	if c, ok := CardDict[name]; ok {
+		return c
+	}
+	if s := strings.TrimSuffix(name, "ies"); s != name {
+		if c, ok := CardDict[s+"y"]; ok {
+			return c
+		}
+	}
+	return CardDict[strings.TrimSuffix(name, "s")]
+}
+
+// newSimpleBuyer returns a SimpleBuyer following rules given either as
+// text or as the name of a file holding them.
+func newSimpleBuyer(spec string) (SimpleBuyer, error) {
+	if _, err := os.Stat(spec); err == nil {
+		rules, err := LoadRules(spec)
+		return SimpleBuyer{rules: rules}, err
+	}
+	rules, err := ParseRules(spec)
+	return SimpleBuyer{rules: rules}, err
+}
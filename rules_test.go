@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	rules, err := ParseRules(`
+Province if total money in deck >= 16  # Not yet.
+Duchy if Provinces left <= 4 and count(Duchy) < 1
+Estate if Duchies left <= 3
+Gold, Silver
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	players := Setup(t, `
+= Alice =
+hand:Gold,Silver,Copper,Copper,Copper
+`)
+	p := players[0]
+	p.manifest = p.hand
+	game := &Game{players: players, supply: map[*Card]int{GetCard("Province"): 4, GetCard("Duchy"): 3}}
+	var got []bool
+	for _, r := range rules {
+		got = append(got, r.holds(game, p))
+	}
+	if fmt.Sprint(got) != "[false true true true true]" {
+		t.Errorf("got %v", got)
+	}
+	for _, s := range []string{"Platinum", "Gold if", "Gold if turn", "Gold if count(Gold >= 1"} {
+		if _, err := ParseRules(s); err == nil {
+			t.Errorf("%q: parsed", s)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// savedGame is the JSON form of a Game between top-level commands, that
+// is, when no card is being played.
+type savedGame struct {
+	Seed                     int64
+	Draws                    int64 // Values drawn from the source seeded with Seed.
+	Turn                     int
+	Player                   int // Whose turn it is.
+	Phase                    int
+	A, B, C                  int
+	ACount, BCount, Discount int
+	Supply                   []savedSupply
+	Trash                    []string
+	Players                  []savedPlayer
+	Data                     map[string]savedValue
+}
+
+type savedSupply struct {
+	Card  string
+	Count int
+	Key   string
+}
+
+type savedPlayer struct {
+	Name                                  string
+	Turns                                 int
+	Manifest, Deck, Hand, Played, Discard []string
+}
+
+// savedValue holds an entry of game.data. Type says which field is used.
+type savedValue struct {
+	Type      string
+	Int       int             `json:",omitempty"`
+	Bool      bool            `json:",omitempty"`
+	Pile      []string        `json:",omitempty"`
+	Counts    map[string]int  `json:",omitempty"`
+	Durations []savedDuration `json:",omitempty"`
+}
+
+type savedDuration struct {
+	Card string
+	Set  []string
+}
+
+// Unknown cards, represented by nil, are saved as "?".
+func pileNames(pile Pile, hide bool) []string {
+	names := make([]string, len(pile))
+	for i, c := range pile {
+		if hide || c == nil {
+			names[i] = "?"
+		} else {
+			names[i] = c.name
+		}
+	}
+	return names
+}
+
+func namesPile(names []string) (Pile, error) {
+	pile := make(Pile, len(names))
+	for i, s := range names {
+		if s == "?" {
+			continue
+		}
+		c, ok := CardDict[s]
+		if !ok {
+			return nil, errors.New("unknown card: " + s)
+		}
+		pile[i] = c
+	}
+	return pile, nil
+}
+
+// Data of these kinds belongs to one player, and is hidden from the others.
+var privateData = []string{"Duration/", "Native Village/"}
+
+// snapshot returns the game as seen by view, or all of it if view is nil.
+func (game *Game) snapshot(view *Player) (*savedGame, error) {
+	if len(game.stack) > 0 {
+		return nil, errors.New("cannot save while " + game.StackTop().card.name + " is being played")
+	}
+	return game.state(view)
+}
+
+// state is like snapshot, but may be taken while a card is being played,
+// when it is a picture of the game rather than enough to restore it.
+func (game *Game) state(view *Player) (*savedGame, error) {
+	sg := &savedGame{
+		Turn:     game.turn,
+		Phase:    game.phase,
+		A:        game.a,
+		B:        game.b,
+		C:        game.c,
+		ACount:   game.aCount,
+		BCount:   game.bCount,
+		Discount: game.discount,
+		Trash:    pileNames(game.trash, false),
+		Data:     make(map[string]savedValue),
+	}
+	if game.p != nil {
+		// No one has had a turn during setup.
+		sg.Player = game.p.n
+	}
+	for _, c := range game.suplist {
+		sg.Supply = append(sg.Supply, savedSupply{c.name, game.supply[c], string(game.keys[c])})
+	}
+	for _, p := range game.players {
+		other := view != nil && view != p
+		sg.Players = append(sg.Players, savedPlayer{
+			Name:     p.name,
+			Turns:    p.turns,
+			Manifest: pileNames(p.manifest, false),
+			Deck:     pileNames(p.deck, view != nil),
+			Hand:     pileNames(p.hand, other),
+			Played:   pileNames(p.played, false),
+			Discard:  pileNames(p.discard, other),
+		})
+	}
+	for key, v := range game.data {
+		hide := false
+		if view != nil {
+			for _, prefix := range privateData {
+				if strings.HasPrefix(key, prefix) && key != prefix+view.name {
+					hide = true
+				}
+			}
+		}
+		var sv savedValue
+		switch t := v.(type) {
+		default:
+			return nil, fmt.Errorf("cannot save %v: %T", key, v)
+		case int:
+			sv = savedValue{Type: "int", Int: t}
+		case bool:
+			sv = savedValue{Type: "bool", Bool: t}
+		case Pile:
+			sv = savedValue{Type: "pile", Pile: pileNames(t, hide)}
+		case map[*Card]int:
+			sv = savedValue{Type: "counts", Counts: make(map[string]int)}
+			for c, n := range t {
+				sv.Counts[c.name] = n
+			}
+		case []Duration:
+			sv = savedValue{Type: "durations"}
+			for _, d := range t {
+				sv.Durations = append(sv.Durations, savedDuration{d.card.name, pileNames(d.set, hide)})
+			}
+		}
+		sg.Data[key] = sv
+	}
+	return sg, nil
+}
+
+// Save writes the game to w. It can only be called between top-level
+// commands. A game restored from w continues exactly as this one does.
+func (game *Game) Save(w io.Writer) error {
+	sg, err := game.snapshot(nil)
+	if err != nil {
+		return err
+	}
+	sg.Seed, sg.Draws = game.seed, game.draws.n
+	b, err := json.MarshalIndent(sg, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// SaveFile saves the game to the named file, replacing it only once the
+// new save is complete.
+func (game *Game) SaveFile(name string) error {
+	f, err := os.Create(name + ".tmp")
+	if err != nil {
+		return err
+	}
+	if err := game.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+// Load restores a game written by Save. The seat function supplies the
+// Player for each name; Load fills in its number and piles. Call resume
+// to continue play.
+func (game *Game) Load(r io.Reader, seat func(name string) *Player) error {
+	var sg savedGame
+	if err := json.NewDecoder(r).Decode(&sg); err != nil {
+		return err
+	}
+	game.Seed(sg.Seed)
+	game.draws.skip(sg.Draws)
+	return game.restore(&sg, seat)
+}
+
+func (game *Game) restore(sg *savedGame, seat func(name string) *Player) error {
+	if sg.Player < 0 || sg.Player >= len(sg.Players) {
+		return errors.New("no such player: " + fmt.Sprint(sg.Player))
+	}
+	game.turn, game.phase = sg.Turn, sg.Phase
+	game.closed = true
+	game.a, game.b, game.c = sg.A, sg.B, sg.C
+	game.aCount, game.bCount, game.discount = sg.ACount, sg.BCount, sg.Discount
+	game.stack = nil
+	var err error
+	if game.trash, err = namesPile(sg.Trash); err != nil {
+		return err
+	}
+	game.suplist = nil
+	game.supply = make(map[*Card]int)
+	game.keys = make(map[*Card]byte)
+	for _, s := range sg.Supply {
+		c, ok := CardDict[s.Card]
+		if !ok || len(s.Key) != 1 {
+			return errors.New("bad supply pile: " + s.Card)
+		}
+		game.supply[c], game.keys[c] = s.Count, s.Key[0]
+		game.suplist = append(game.suplist, c)
+	}
+	game.players = nil
+	for i, sp := range sg.Players {
+		p := seat(sp.Name)
+		p.name, p.n, p.turns = sp.Name, i, sp.Turns
+		for _, x := range []struct {
+			pp    *Pile
+			names []string
+		}{
+			{&p.manifest, sp.Manifest},
+			{&p.deck, sp.Deck},
+			{&p.hand, sp.Hand},
+			{&p.played, sp.Played},
+			{&p.discard, sp.Discard},
+		} {
+			if *x.pp, err = namesPile(x.names); err != nil {
+				return err
+			}
+		}
+		game.players = append(game.players, p)
+	}
+	game.p = game.players[sg.Player]
+	game.data = make(map[string]interface{})
+	for key, sv := range sg.Data {
+		switch sv.Type {
+		default:
+			return errors.New("bad type for " + key + ": " + sv.Type)
+		case "int":
+			game.data[key] = sv.Int
+		case "bool":
+			game.data[key] = sv.Bool
+		case "pile":
+			if game.data[key], err = namesPile(sv.Pile); err != nil {
+				return err
+			}
+		case "counts":
+			m := make(map[*Card]int)
+			for s, n := range sv.Counts {
+				c, ok := CardDict[s]
+				if !ok {
+					return errors.New("unknown card: " + s)
+				}
+				m[c] = n
+			}
+			game.data[key] = m
+		case "durations":
+			var list []Duration
+			for _, d := range sv.Durations {
+				c, ok := CardDict[d.Card]
+				if !ok || c.duration == nil {
+					return errors.New("not a Duration card: " + d.Card)
+				}
+				set, err := namesPile(d.Set)
+				if err != nil {
+					return err
+				}
+				list = append(list, Duration{c, set})
+			}
+			game.data[key] = list
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	players := Setup(t, `
+= Alice =
+hand:Copper,Estate
+deck:Gold,Silver
+discard:Copper
+= Bob =
+hand:Province
+played:Haven
+`)
+	game := &Game{players: players}
+	game.NewGame()
+	game.StartTurn(1)
+	game.rng.Intn(10)
+	game.rng.Perm(5)
+	twin := rand.New(rand.NewSource(game.seed))
+	twin.Intn(10)
+	twin.Perm(5)
+	game.suplist = append(game.suplist, GetCard("Silver"))
+	game.data["Duration/Bob"] = []Duration{{GetCard("Haven"), ParsePile("Gold")}}
+	game.data["Embargo"].(map[*Card]int)[GetCard("Silver")] = 2
+	game.trash = ParsePile("Curse")
+	var b bytes.Buffer
+	if err := game.Save(&b); err != nil {
+		t.Fatal(err)
+	}
+	loaded := &Game{}
+	if err := loaded.Load(&b, func(name string) *Player { return &Player{name: name} }); err != nil {
+		t.Fatal(err)
+	}
+	CheckPiles(t, loaded.players, `
+= Alice =
+hand:Copper,Estate
+deck:Gold,Silver
+discard:Copper
+= Bob =
+hand:Province
+played:Haven
+`)
+	if loaded.p.name != "Bob" || loaded.turn != 1 || loaded.phase != phAction {
+		t.Errorf("wrong turn: %v %v %v", loaded.p.name, loaded.turn, loaded.phase)
+	}
+	if msg := ComparePiles(loaded.trash, ParsePile("Curse")); msg != "" {
+		t.Errorf("trash: %v", msg)
+	}
+	if n := loaded.data["Embargo"].(map[*Card]int)[GetCard("Silver")]; n != 2 {
+		t.Errorf("want 2 Embargo tokens, got %v", n)
+	}
+	d := loaded.data["Duration/Bob"].([]Duration)
+	if len(d) != 1 || d[0].card != GetCard("Haven") || ComparePiles(d[0].set, ParsePile("Gold")) != "" {
+		t.Errorf("wrong Durations: %v", d)
+	}
+	n := twin.Int63()
+	if game.rng.Int63() != n || loaded.rng.Int63() != n {
+		t.Errorf("saving disturbed the game, or saved and loaded games diverge")
+	}
+}
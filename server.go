@@ -0,0 +1,547 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// web holds the page served at /, for playing from a browser.
+//
+//go:embed web
+var web embed.FS
+
+// A table is a game hosted by the server. Tables are numbered from 1.
+type table struct {
+	id      int
+	game    *Game
+	clients map[string]*netGamer
+	tokens  map[string]string // Session token of each client, by name.
+	resume  bool              // Only players of the saved game may join.
+	joined  chan bool         // Signalled when a seat of a resumed game is filled.
+
+	watchers map[string]watcher // Spectators, by session token.
+}
+
+// A watcher is a spectator at a table.
+type watcher struct {
+	ng       *netGamer
+	p        *Player
+	attached bool // Whether the spectator has opened a stream.
+}
+
+// How long a spectator has to open a stream before being dropped.
+const watchTimeout = 30 * time.Second
+
+// lobby holds the tables of a server.
+type lobby struct {
+	sync.Mutex
+	tables map[int]*table
+	last   int
+	record string // Directory in which to record games.
+
+	// Plays the games at a table a player opens; tests may stub it out.
+	play func(t *table)
+}
+
+func newLobby(record string) *lobby {
+	lb := &lobby{tables: make(map[int]*table), record: record}
+	lb.play = func(t *table) { lb.serve(t, 0) }
+	return lb
+}
+
+// add seats game at a new table.
+func (lb *lobby) add(game *Game) *table {
+	lb.Lock()
+	defer lb.Unlock()
+	lb.last++
+	t := &table{id: lb.last, game: game, clients: make(map[string]*netGamer), tokens: make(map[string]string), joined: make(chan bool),
+		watchers: make(map[string]watcher)}
+	lb.tables[t.id] = t
+	return t
+}
+
+// table returns the table named by the request.
+func (lb *lobby) table(r *http.Request) (*table, error) {
+	n, err := strconv.Atoi(r.FormValue("table"))
+	if err != nil {
+		return nil, errors.New("bad table")
+	}
+	return lb.find(n)
+}
+
+// find returns table n.
+func (lb *lobby) find(n int) (*table, error) {
+	lb.Lock()
+	defer lb.Unlock()
+	t, ok := lb.tables[n]
+	if !ok {
+		return nil, errors.New("no such table")
+	}
+	return t, nil
+}
+
+// client returns the table and netGamer named by the request, which
+// must hold the session token of the client.
+func (lb *lobby) client(r *http.Request) (*table, *netGamer, error) {
+	t, err := lb.table(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	lb.Lock()
+	defer lb.Unlock()
+	id := r.FormValue("id")
+	ng, ok := t.clients[id]
+	if !ok {
+		return nil, nil, errors.New("no such id")
+	}
+	token := r.FormValue("token")
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(t.tokens[id])) != 1 {
+		return nil, nil, errors.New("bad token")
+	}
+	return t, ng, nil
+}
+
+// listener returns the table and netGamer named by the request, like
+// client, or if it names no one, the spectator with its token.
+func (lb *lobby) listener(r *http.Request) (*table, *netGamer, error) {
+	if r.FormValue("id") != "" {
+		return lb.client(r)
+	}
+	t, err := lb.table(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	lb.Lock()
+	defer lb.Unlock()
+	w, ok := t.watchers[r.FormValue("token")]
+	if !ok {
+		return nil, nil, errors.New("bad token")
+	}
+	return t, w.ng, nil
+}
+
+// newToken returns a secret for a client to present with its requests.
+func newToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// renew replaces the session tokens of a table once a game ends, and
+// sends each client its new one.
+func (lb *lobby) renew(t *table) {
+	lb.Lock()
+	var ps []*Player
+	var tokens []string
+	for _, p := range t.game.players {
+		if _, ok := t.clients[p.name]; ok {
+			t.tokens[p.name] = newToken()
+			ps = append(ps, p)
+			tokens = append(tokens, t.tokens[p.name])
+		}
+	}
+	lb.Unlock()
+	for i, p := range ps {
+		p.recv <- message{Type: "token", Token: tokens[i]}
+	}
+}
+
+// serve plays one game after another at the table, until n have been
+// played, or without end if n is not positive. It reports whether it
+// stopped because a local player quit.
+func (lb *lobby) serve(t *table, n int) bool {
+	game := t.game
+	for i := 0; n <= 0 || i < n; i++ {
+		var f *os.File
+		if lb.record != "" {
+			var err error
+			f, err = os.Create(filepath.Join(lb.record, fmt.Sprintf("%v.replay", game.seed)))
+			if err != nil {
+				log.Fatal(err)
+			}
+			game.rec = f
+		}
+		r := singleGame(game)
+		if f != nil {
+			f.Close()
+		}
+		if r.quit {
+			return true
+		}
+		lb.renew(t)
+		game.seed = game.rng.Int63()
+	}
+	return false
+}
+
+// count returns the number of tables.
+func (lb *lobby) count() int {
+	lb.Lock()
+	defer lb.Unlock()
+	return len(lb.tables)
+}
+
+// reg seats a player, given a hello. Table 0 opens a table at which
+// the player sits first and decides when to start.
+func (lb *lobby) reg(w http.ResponseWriter, r *http.Request) {
+	var h hello
+	if err := json.NewDecoder(r.Body).Decode(&h); err != nil {
+		writeReply(w, reply{Version: protocolVersion, Error: "malformed hello"})
+		return
+	}
+	fail := func(msg string) {
+		writeReply(w, reply{Version: protocolVersion, Error: msg})
+	}
+	if h.Version != protocolVersion {
+		fail(fmt.Sprintf("protocol version %v not supported, want %v", h.Version, protocolVersion))
+		return
+	}
+	name := h.Name
+	if name == "" {
+		fail("nil name")
+		return
+	}
+	var t *table
+	if h.Table == 0 {
+		game := newGame()
+		game.seed = time.Now().UnixNano()
+		go logEvents(game.Subscribe())
+		t = lb.add(game)
+		defer func() { go lb.play(t) }()
+	} else {
+		var err error
+		if t, err = lb.find(h.Table); err != nil {
+			fail(err.Error())
+			return
+		}
+	}
+	game := t.game
+	lb.Lock()
+	var seat *Player
+	for _, p := range game.seated() {
+		if p.name == name {
+			if p.fun != nil {
+				lb.Unlock()
+				fail("name already taken")
+				return
+			}
+			seat = p
+		}
+	}
+	ng := &netGamer{
+		in:     make(chan Command),
+		out:    make(chan string),
+		attach: make(chan chan message),
+		rejoin: make(chan bool),
+		views:  h.Views,
+		nack:   make(chan unsent),
+	}
+	p := seat
+	if p == nil {
+		p = &Player{name: name, fun: ng, trigger: make(chan bool), recv: make(chan message)}
+		if err := game.sit(p); err != nil {
+			lb.Unlock()
+			if err == errInProgress && t.resume {
+				fail("waiting for players of saved game")
+			} else {
+				fail(err.Error())
+			}
+			return
+		}
+	} else {
+		p.fun, p.recv = ng, make(chan message)
+	}
+	t.clients[name] = ng
+	token := newToken()
+	t.tokens[name] = token
+	lb.Unlock()
+	go ng.start(game, p)
+	writeReply(w, reply{Version: protocolVersion, Table: t.id, Token: token})
+	fmt.Printf("%v joined table %v\n", name, t.id)
+	if seat != nil {
+		sg, err := game.snapshot(p)
+		if err != nil {
+			panic(err)
+		}
+		p.recv <- message{Type: "resume", View: sg}
+		t.joined <- true
+	}
+}
+
+func (lb *lobby) discard(w http.ResponseWriter, r *http.Request) {
+	t, _, err := lb.listener(r)
+	if err != nil {
+		writeReply(w, reply{Error: err.Error()})
+		return
+	}
+	game := t.game
+	n, err := strconv.Atoi(r.FormValue("n"))
+	players := game.seated()
+	if err != nil || n < 0 || n >= len(players) {
+		writeReply(w, reply{Error: "no such player"})
+		return
+	}
+	p := players[n]
+	if len(p.discard) == 0 {
+		writeReply(w, reply{Error: "no discards"})
+		return
+	}
+	writeReply(w, reply{Card: game.GetDiscard(game, p)})
+}
+
+// reconnect gives a seat whose client has lost the game a new session
+// token, given a hello with the old one. The client is sent the game
+// again when it next opens a stream.
+func (lb *lobby) reconnect(w http.ResponseWriter, r *http.Request) {
+	var h hello
+	if err := json.NewDecoder(r.Body).Decode(&h); err != nil {
+		writeReply(w, reply{Version: protocolVersion, Error: "malformed hello"})
+		return
+	}
+	fail := func(msg string) {
+		writeReply(w, reply{Version: protocolVersion, Error: msg})
+	}
+	if h.Version != protocolVersion {
+		fail(fmt.Sprintf("protocol version %v not supported, want %v", h.Version, protocolVersion))
+		return
+	}
+	t, err := lb.find(h.Table)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	lb.Lock()
+	ng, ok := t.clients[h.Name]
+	if !ok || h.Token == "" || subtle.ConstantTimeCompare([]byte(h.Token), []byte(t.tokens[h.Name])) != 1 {
+		lb.Unlock()
+		fail("bad token")
+		return
+	}
+	token := newToken()
+	t.tokens[h.Name] = token
+	lb.Unlock()
+	ng.rejoin <- h.Views
+	writeReply(w, reply{Version: protocolVersion, Table: t.id, Token: token})
+	fmt.Printf("%v rejoined table %v\n", h.Name, t.id)
+}
+
+// watch seats a spectator, given a hello naming the table.
+func (lb *lobby) watch(w http.ResponseWriter, r *http.Request) {
+	var h hello
+	if err := json.NewDecoder(r.Body).Decode(&h); err != nil {
+		writeReply(w, reply{Version: protocolVersion, Error: "malformed hello"})
+		return
+	}
+	if h.Version != protocolVersion {
+		writeReply(w, reply{Version: protocolVersion, Error: fmt.Sprintf("protocol version %v not supported, want %v", h.Version, protocolVersion)})
+		return
+	}
+	t, err := lb.find(h.Table)
+	if err != nil {
+		writeReply(w, reply{Version: protocolVersion, Error: err.Error()})
+		return
+	}
+	quit := make(chan bool)
+	x := watcher{
+		ng: &netGamer{
+			in:     make(chan Command),
+			out:    make(chan string),
+			attach: make(chan chan message),
+			rejoin: make(chan bool),
+			views:  h.Views,
+			quit:   quit,
+			nack:   make(chan unsent),
+		},
+		p: &Player{trigger: make(chan bool), recv: make(chan message), gone: quit},
+	}
+	token := newToken()
+	lb.Lock()
+	t.watchers[token] = x
+	lb.Unlock()
+	go x.ng.start(t.game, x.p)
+	t.game.Watch(x.p)
+	time.AfterFunc(watchTimeout, func() {
+		lb.Lock()
+		x, ok := t.watchers[token]
+		lb.Unlock()
+		if ok && !x.attached {
+			lb.unwatch(t, token)
+		}
+	})
+	writeReply(w, reply{Version: protocolVersion, Table: t.id, Token: token})
+	fmt.Printf("A spectator joined table %v\n", t.id)
+}
+
+// unwatch removes the spectator with the given token.
+func (lb *lobby) unwatch(t *table, token string) {
+	lb.Lock()
+	x, ok := t.watchers[token]
+	delete(t.watchers, token)
+	lb.Unlock()
+	if ok {
+		t.game.Unwatch(x.p)
+		close(x.ng.quit)
+		fmt.Printf("A spectator left table %v\n", t.id)
+	}
+}
+
+// events streams a player's messages as server-sent events, one JSON
+// message to an event. A newer stream for the player ends this one. A
+// spectator leaves when their stream ends.
+func (lb *lobby) events(w http.ResponseWriter, r *http.Request) {
+	t, ng, err := lb.listener(r)
+	if err != nil {
+		writeReply(w, reply{Error: err.Error()})
+		return
+	}
+	if token := r.FormValue("token"); r.FormValue("id") == "" {
+		lb.Lock()
+		if x, ok := t.watchers[token]; ok {
+			x.attached = true
+			t.watchers[token] = x
+		}
+		lb.Unlock()
+		defer lb.unwatch(t, token)
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeReply(w, reply{Error: "cannot stream"})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+	c := make(chan message)
+	select {
+	case ng.attach <- c:
+	case <-ng.quit:
+		return
+	}
+	for {
+		select {
+		case m, ok := <-c:
+			if !ok {
+				return
+			}
+			b, err := json.Marshal(m)
+			if err != nil {
+				panic(err)
+			}
+			_, err = fmt.Fprintf(w, "data: %s\n\n", b)
+			if err == nil {
+				flusher.Flush()
+				err = r.Context().Err()
+			}
+			if err != nil {
+				// The client may not have it; give it back for the next stream.
+				select {
+				case ng.nack <- unsent{c, m}:
+				case <-ng.quit:
+				}
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (lb *lobby) cmd(w http.ResponseWriter, r *http.Request) {
+	_, ng, err := lb.client(r)
+	if err != nil {
+		log.Print("error: ", err)
+		writeReply(w, reply{Error: err.Error()})
+		return
+	}
+	var wc wireCommand
+	if err := json.NewDecoder(r.Body).Decode(&wc); err != nil {
+		writeReply(w, reply{Error: "malformed command"})
+		return
+	}
+	if wc.Cmd == "" {
+		log.Print("error: no command")
+		writeReply(w, reply{Error: "no command"})
+		return
+	}
+	cmd, err := decodeCommand(&wc)
+	if err != nil {
+		writeReply(w, reply{Error: err.Error()})
+		return
+	}
+	ng.in <- cmd
+	writeReply(w, reply{Error: <-ng.out})
+}
+
+// chat passes on what a player says to everyone at the table.
+func (lb *lobby) chat(w http.ResponseWriter, r *http.Request) {
+	t, _, err := lb.client(r)
+	if err != nil {
+		writeReply(w, reply{Error: err.Error()})
+		return
+	}
+	var line chatLine
+	if err := json.NewDecoder(r.Body).Decode(&line); err != nil {
+		writeReply(w, reply{Error: "malformed chat"})
+		return
+	}
+	text := strings.TrimSpace(line.Text)
+	switch {
+	case text == "":
+		writeReply(w, reply{Error: "nothing said"})
+	case utf8.RuneCountInString(text) > maxChat:
+		writeReply(w, reply{Error: fmt.Sprintf("longer than %v characters", maxChat)})
+	case strings.IndexFunc(text, unicode.IsControl) >= 0:
+		writeReply(w, reply{Error: "control characters"})
+	default:
+		t.game.chat(r.FormValue("id"), text)
+		writeReply(w, reply{})
+	}
+}
+
+// listen starts the HTTP server on addr and waits until it answers.
+func (lb *lobby) listen(addr string) {
+	http.HandleFunc("/reg", lb.reg)
+	http.HandleFunc("/discard", lb.discard)
+	http.HandleFunc("/reconnect", lb.reconnect)
+	http.HandleFunc("/watch", lb.watch)
+	http.HandleFunc("/events", lb.events)
+	http.HandleFunc("/cmd", lb.cmd)
+	http.HandleFunc("/chat", lb.chat)
+	site, err := fs.Sub(web, "web")
+	if err != nil {
+		panic(err)
+	}
+	http.Handle("/", http.FileServer(http.FS(site)))
+	go func() { log.Fatal(http.ListenAndServe(addr, nil)) }()
+	time.Sleep(8 * time.Millisecond)
+	for n := 0; ; n++ {
+		resp, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			if n > 3 {
+				log.Fatal("failed to connect 3 times: ", err)
+			}
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		resp.Body.Close()
+		break
+	}
+}
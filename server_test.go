@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProtocol(t *testing.T) {
+	lb := newLobby("")
+	for _, x := range []struct {
+		body, err string
+	}{
+		{`{"Version": 2, "Name": "Alice"}`, "protocol version 2 not supported, want 1"},
+		{`{"Version": 1}`, "nil name"},
+		{`{"Version": 1, "Name": "Alice", "Table": 9}`, "no such table"},
+		{`Alice`, "malformed hello"},
+	} {
+		w := httptest.NewRecorder()
+		lb.reg(w, httptest.NewRequest("POST", "/reg", strings.NewReader(x.body)))
+		var rep reply
+		if err := json.NewDecoder(w.Body).Decode(&rep); err != nil {
+			t.Fatal(err)
+		}
+		if rep.Version != protocolVersion || rep.Error != x.err {
+			t.Errorf("%v: want error %q, got %+v", x.body, x.err, rep)
+		}
+	}
+	cmd := Command{s: "buy", c: GetCard("Silver")}
+	b, err := json.Marshal(message{Type: "cmd", Cmd: encodeCommand(cmd)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Type":"cmd","Cmd":{"Cmd":"buy","Card":"Silver"}}`; string(b) != want {
+		t.Errorf("want %v, got %s", want, b)
+	}
+	var m message
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := decodeCommand(m.Cmd); err != nil || got != cmd {
+		t.Errorf("want %v, got %v, %v", cmd, got, err)
+	}
+	if m := cardMessage("draw", GetCard("Gold"), nil); m.pile()[0] != GetCard("Gold") || m.pile()[1] != nil {
+		t.Errorf("draw: got %v", m.Cards)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	lb := newLobby("")
+	lb.play = func(*table) {} // No game, which would outlive the test.
+	w := httptest.NewRecorder()
+	lb.reg(w, httptest.NewRequest("POST", "/reg", strings.NewReader(`{"Version": 1, "Name": "Alice"}`)))
+	var rep reply
+	if err := json.NewDecoder(w.Body).Decode(&rep); err != nil {
+		t.Fatal(err)
+	}
+	if rep.Token == "" {
+		t.Fatalf("no token: %+v", rep)
+	}
+	seat := fmt.Sprintf("table=%v&id=Alice&token=", rep.Table)
+	check := func(q, want string) {
+		_, _, err := lb.client(httptest.NewRequest("GET", "/cmd?"+q, nil))
+		if got := fmt.Sprint(err); err == nil && want != "" || err != nil && got != want {
+			t.Errorf("%v: want %q, got %v", q, want, err)
+		}
+	}
+	check(seat+rep.Token, "")
+	check(seat, "bad token")
+	check(seat+"x"+rep.Token, "bad token")
+	check(fmt.Sprintf("table=%v&id=Bob&token=%v", rep.Table, rep.Token), "no such id")
+	table := lb.tables[rep.Table]
+	lb.renew(table)
+	check(seat+rep.Token, "bad token")
+	lb.Lock()
+	token := table.tokens["Alice"]
+	lb.Unlock()
+	check(seat+token, "")
+}
+
+func TestSeats(t *testing.T) {
+	lb := newLobby("")
+	lb.play = func(*table) {} // No game, which would outlive the test.
+	join := func(table int, name string) reply {
+		w := httptest.NewRecorder()
+		lb.reg(w, httptest.NewRequest("POST", "/reg", strings.NewReader(fmt.Sprintf(`{"Version": 1, "Name": %q, "Table": %v}`, name, table))))
+		var rep reply
+		if err := json.NewDecoder(w.Body).Decode(&rep); err != nil {
+			t.Fatal(err)
+		}
+		return rep
+	}
+	id := join(0, "P1").Table
+	game := lb.tables[id].game
+	if err := game.closeSeats(); fmt.Sprint(err) != "need at least 2 players" {
+		t.Errorf("one player: want need at least 2 players, got %v", err)
+	}
+	for i := 2; i <= maxPlayers; i++ {
+		if rep := join(id, fmt.Sprintf("P%v", i)); rep.Error != "" {
+			t.Fatalf("P%v: %v", i, rep.Error)
+		}
+	}
+	if rep := join(id, "P7"); rep.Error != "table full" {
+		t.Errorf("want table full, got %q", rep.Error)
+	}
+	if err := game.closeSeats(); err != nil {
+		t.Fatal(err)
+	}
+	id = join(0, "Q1").Table
+	if err := lb.tables[id].game.closeSeats(); err == nil {
+		t.Fatal("closed with one player")
+	}
+	join(id, "Q2")
+	if err := lb.tables[id].game.closeSeats(); err != nil {
+		t.Fatal(err)
+	}
+	if rep := join(id, "Q3"); rep.Error != "game in progress" {
+		t.Errorf("want game in progress, got %q", rep.Error)
+	}
+	game = newGame()
+	for i := 0; i <= maxPlayers; i++ {
+		game.players = append(game.players, &Player{})
+	}
+	if err := game.closeSeats(); err == nil {
+		t.Errorf("closed with %v players", len(game.players))
+	}
+}
+
+func TestChat(t *testing.T) {
+	lb := newLobby("")
+	lb.play = func(*table) {} // No game, which would outlive the test.
+	w := httptest.NewRecorder()
+	lb.reg(w, httptest.NewRequest("POST", "/reg", strings.NewReader(`{"Version": 1, "Name": "Alice"}`)))
+	var rep reply
+	if err := json.NewDecoder(w.Body).Decode(&rep); err != nil {
+		t.Fatal(err)
+	}
+	stream := make(chan message)
+	lb.tables[rep.Table].clients["Alice"].attach <- stream
+	for _, x := range []struct {
+		text, err string
+	}{
+		{"  ", "nothing said"},
+		{strings.Repeat("x", maxChat+1), "longer than 200 characters"},
+		{"a\tb", "control characters"},
+		{" good game ", ""},
+	} {
+		b, _ := json.Marshal(chatLine{x.text})
+		w := httptest.NewRecorder()
+		lb.chat(w, httptest.NewRequest("POST", fmt.Sprintf("/chat?table=%v&id=Alice&token=%v", rep.Table, rep.Token), bytes.NewReader(b)))
+		var got reply
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Error != x.err {
+			t.Errorf("%q: want error %q, got %q", x.text, x.err, got.Error)
+		}
+	}
+	for m := range stream {
+		if m.Type == "chat" {
+			if m.From != "Alice" || m.Text != "good game" {
+				t.Errorf("want Alice saying %q, got %+v", "good game", m)
+			}
+			break
+		}
+	}
+}
+
+func TestRejoin(t *testing.T) {
+	ng := netGamer{in: make(chan Command), out: make(chan string), attach: make(chan chan message), rejoin: make(chan bool)}
+	p := &Player{name: "Alice", trigger: make(chan bool), recv: make(chan message)}
+	go ng.start(newGame(), p)
+	stream := make(chan message)
+	ng.attach <- stream
+	cmd := encodeCommand(Command{s: "play", c: GetCard("Copper")})
+	for _, m := range []message{
+		{Type: "new"},
+		{Type: "mark", View: &savedGame{Turn: 3}},
+		{Type: "cmd", Cmd: cmd},
+		cardMessage("draw", GetCard("Gold")),
+		{Type: "error", Error: "bad"},
+	} {
+		p.recv <- m
+	}
+	p.trigger <- true
+	var got []string
+	for i := 0; i < 5; i++ {
+		got = append(got, (<-stream).Type)
+	}
+	if want := "new cmd draw error go"; strings.Join(got, " ") != want {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	ng.rejoin <- false
+	if _, ok := <-stream; ok {
+		t.Error("old stream still open")
+	}
+	stream = make(chan message)
+	ng.attach <- stream
+	m := <-stream
+	if m.Type != "resume" || m.View.Turn != 3 || len(m.Redo) != 1 || m.Redo[0] != *cmd {
+		t.Errorf("want resume from turn 3 redoing %v, got %+v", *cmd, m)
+	}
+	got = nil
+	for i := 0; i < 2; i++ {
+		got = append(got, (<-stream).Type)
+	}
+	if want := "draw go"; strings.Join(got, " ") != want {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestNack(t *testing.T) {
+	ng := netGamer{in: make(chan Command), out: make(chan string), attach: make(chan chan message), rejoin: make(chan bool), nack: make(chan unsent)}
+	p := &Player{name: "Alice", trigger: make(chan bool), recv: make(chan message)}
+	go ng.start(newGame(), p)
+	stream := make(chan message)
+	ng.attach <- stream
+	p.recv <- message{Type: "new"}
+	p.recv <- cardMessage("draw", GetCard("Gold"))
+	<-stream
+	m := <-stream
+	ng.nack <- unsent{stream, m}
+	p.recv <- message{Type: "error", Error: "bad"}
+	stream = make(chan message)
+	ng.attach <- stream
+	if got := (<-stream).Type + " " + (<-stream).Type; got != "draw error" {
+		t.Errorf("want the unsent draw again, then the error; got %v", got)
+	}
+	// After a rejoin, the resume covers what was unsent.
+	p.recv <- cardMessage("draw", GetCard("Silver"))
+	m = <-stream
+	ng.rejoin <- false
+	ng.nack <- unsent{stream, m}
+	stream = make(chan message)
+	ng.attach <- stream
+	var got []string
+	for i := 0; i < 3; i++ {
+		got = append(got, (<-stream).Type)
+	}
+	if want := "new draw draw"; strings.Join(got, " ") != want {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	select {
+	case m := <-stream:
+		t.Errorf("unexpected %+v", m)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestViews(t *testing.T) {
+	players := Setup(t, `
+= Alice =
+hand:Cellar,Estate,Copper
+deck:Silver
+= Bob =
+hand:Gold
+`)
+	game := newGame()
+	game.players = players
+	game.NewGame()
+	game.StartTurn(0)
+	game.suplist = ParsePile("Province")
+	alice := players[0]
+	alice.recv = make(chan message)
+	ng := netGamer{in: make(chan Command), out: make(chan string), attach: make(chan chan message), rejoin: make(chan bool), views: true}
+	go ng.start(game, alice)
+	stream := make(chan message)
+	ng.attach <- stream
+	go game.resume()
+	next := func() message {
+		for m := range stream {
+			if m.Type == "go" {
+				return m
+			}
+		}
+		panic("stream ended")
+	}
+	m := next()
+	if m.Ask == nil || m.Ask.Kind != "top" || strings.Join(m.Ask.Options, ",") != "Cellar" {
+		t.Fatalf("want top decision to play Cellar, got %+v", m.Ask)
+	}
+	if got := strings.Join(m.View.Players[0].Hand, ","); got != "Cellar,Estate,Copper" {
+		t.Errorf("want own hand, got %v", got)
+	}
+	if got := strings.Join(m.View.Players[1].Hand, ","); got != "?" {
+		t.Errorf("want Bob's hand hidden, got %v", got)
+	}
+	if m.Costs["Province"] != 8 {
+		t.Errorf("want Province costing 8, got %v", m.Costs["Province"])
+	}
+	cmd := Command{s: "play", c: GetCard("Cellar")}
+	for _, want := range []string{"Estate,Copper", "Copper"} {
+		if ng.in <- cmd; <-ng.out != "" {
+			t.Fatal("command refused")
+		}
+		m = next()
+		if m.Ask == nil || m.Ask.Kind != "split" || m.Ask.Card != "Cellar" || m.Ask.Prompt == "" {
+			t.Fatalf("want Cellar asking to pick, got %+v", m.Ask)
+		}
+		if got := strings.Join(m.Ask.Options, ","); got != want {
+			t.Errorf("want options %v, got %v", want, got)
+		}
+		cmd = Command{s: "pick", c: GetCard("Estate")}
+	}
+}
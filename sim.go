@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+// findPreset returns the preset with the given name, ignoring case.
+func findPreset(name string) *Preset {
+	for i := range presets {
+		if strings.EqualFold(presets[i].name, name) {
+			return &presets[i]
+		}
+	}
+	return nil
+}
+
+// newBot returns a bot described by spec: a MonteCarlo spec (see
+// parseMonteCarlo), buy rules, or the name of a file holding them. Buy
+// rules after "heuristic:" are for a Heuristic bot. A bot that makes
+// random choices draws them from seed.
+func newBot(spec string, seed int64) (PlayFun, error) {
+	if mc, ok, err := parseMonteCarlo(spec, seed); ok {
+		return mc, err
+	}
+	if strings.HasPrefix(strings.ToLower(spec), "heuristic:") {
+		return newHeuristic(spec[len("heuristic:"):])
+	}
+	return newSimpleBuyer(spec)
+}
+
+// botUsage describes bot specs, for usage messages.
+const botUsage = `A bot is a file of buy rules, or the rules themselves, e.g. "Province,Gold,Silver",
+or montecarlo[:playouts|:time], e.g. "montecarlo:500ms".
+Buy rules after "heuristic:" are for a bot that also plays its actions.
+`
+
+// newSim returns a game for bots to play with no one watching, and a
+// player for each bot spec, seeded from rng.
+func newSim(specs []string, maxTurns int, rng *rand.Rand) (*Game, []*Player, error) {
+	game := newGame()
+	game.maxTurns = maxTurns
+	game.noUndo = true
+	var bots []*Player
+	for i, spec := range specs {
+		fun, err := newBot(spec, rng.Int63())
+		if err != nil {
+			return nil, nil, err
+		}
+		bots = append(bots, &Player{name: fmt.Sprintf("#%v", i+1), fun: fun, trigger: make(chan bool)})
+	}
+	for _, p := range bots {
+		go p.fun.start(game, p)
+	}
+	return game, bots, nil
+}
+
+// simGame plays a game of pr between the given players, seated in order,
+// recording it if game.rec is set.
+func simGame(game *Game, players []*Player, pr *Preset, seed int64) *Result {
+	game.players = players
+	for k, p := range players {
+		p.n = k
+	}
+	game.Reset()
+	game.Seed(seed)
+	game.recordHeader(*pr)
+	game.deal(*pr)
+	return game.mainloop()
+}
+
+// rotate returns the players with the one at i first, so that they take
+// turns in the first seat.
+func rotate(players []*Player, i int) []*Player {
+	var v []*Player
+	for k := range players {
+		v = append(v, players[(i+k)%len(players)])
+	}
+	return v
+}
+
+// simStats are the totals for one bot over a batch of games.
+type simStats struct {
+	spec string
+	wins float64 // A shared win counts as a fraction.
+	vp   int
+}
+
+// sim plays bots against each other and reports how each fared. Each
+// argument describes a bot; see newBot.
+func sim(args []string) {
+	fs := flag.NewFlagSet("sim", flag.ExitOnError)
+	n := fs.Int("n", 1000, "number of games")
+	presetName := fs.String("preset", "First Game", "kingdom preset")
+	seed := fs.Int64("seed", 0, "random seed; 0 picks one from the clock")
+	maxTurns := fs.Int("maxturns", 400, "end a game after this many turns in all")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gominion sim [flags] bot bot...\n")
+		fmt.Fprint(os.Stderr, botUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 2 || fs.NArg() > 6 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	pr := findPreset(*presetName)
+	if pr == nil {
+		log.Fatalf("no such preset: %q", *presetName)
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(*seed))
+	game, bots, err := newSim(fs.Args(), *maxTurns, rng)
+	if err != nil {
+		log.Fatal(err)
+	}
+	stats := make(map[*Player]*simStats)
+	for i, p := range bots {
+		stats[p] = &simStats{spec: fs.Arg(i)}
+	}
+	var firstWins float64
+	rounds := 0
+	for i := 0; i < *n; i++ {
+		r := simGame(game, rotate(bots, i), pr, rng.Int63())
+		w := r.Winners()
+		for k, x := range r.players {
+			st := stats[game.players[k]]
+			st.vp += x.score
+			if x.place == 1 {
+				st.wins += 1 / float64(len(w))
+				if k == 0 {
+					firstWins += 1 / float64(len(w))
+				}
+			}
+		}
+		// The first player has had the most turns.
+		rounds += r.players[0].turns
+	}
+	fmt.Printf("%v games of %q, seed %v\n", *n, pr.name, *seed)
+	for _, p := range bots {
+		st := stats[p]
+		fmt.Printf("%v: won %.1f%%, average %.1f VP: %v\n", p.name, 100*st.wins/float64(*n), float64(st.vp)/float64(*n), st.spec)
+	}
+	fmt.Printf("Average length: %.1f turns each\n", float64(rounds)/float64(*n))
+	fmt.Printf("First seat won %.1f%% (%.1f%% if it made no difference)\n", 100*firstWins/float64(*n), 100/float64(len(bots)))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestNewBot(t *testing.T) {
+	if _, err := newBot("Province, Gold,Silver", 1); err != nil {
+		t.Error(err)
+	}
+	if _, err := newBot("Province,Platinum", 1); err == nil {
+		t.Error("accepted unknown card")
+	}
+	if _, err := newBot("montecarlo:1s", 1); err != nil {
+		t.Error(err)
+	}
+	if _, err := newBot("montecarlo:lots", 1); err == nil {
+		t.Error("accepted bad playouts")
+	}
+	if findPreset("big money") == nil {
+		t.Error("preset names should ignore case")
+	}
+}
+
+func TestSimGame(t *testing.T) {
+	game, bots, err := newSim([]string{"Province,Gold,Silver", "Province,Duchy,Gold,Silver"}, 400, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr := findPreset("Big Money")
+	a := simGame(game, bots, pr, 5).String()
+	if b := simGame(game, bots, pr, 5).String(); a != b {
+		t.Errorf("same seed, different games:\n%v\n%v", a, b)
+	}
+}
@@ -1,68 +1,26 @@
 package main
 
+// SimpleBuyer plays all its treasures and buys by its rules; see rules.go.
+// Otherwise it decides as DefaultDecider does.
 type SimpleBuyer struct {
-	list []string
+	DefaultDecider
+	rules []BuyRule
 }
 
-func (this SimpleBuyer) start(game *Game, p *Player) {
-	for {
-		<-p.trigger
-		if frame := game.StackTop(); frame != nil {
-			switch frame.card.name {
-			case "Bureaucrat":
-				for _, c := range p.hand {
-					if c.IsVictory() {
-						game.ch <- Command{s: "pick", c: c}
-						break
-					}
-				}
-			case "Ghost Ship":
-				fallthrough
-			case "Militia":
-				// Keep first 3 cards.
-				for i := 0; i < 3; i++ {
-					// TODO: Support picks with multiple cards.
-					if i > 0 {
-						<-p.trigger
-					}
-					game.ch <- Command{s: "pick", c: p.hand[i]}
-				}
-			case "Masquerade":
-				// Throw away first card.
-				game.ch <- Command{s: "pick", c: p.hand[0]}
-				continue
-			case "Saboteur":
-				// Pick nothing.
-				game.ch <- Command{s: "pick"}
-				continue
-			case "Torturer":
-				// Choose to gain a Curse.
-				game.ch <- Command{s: "2"}
-				continue
-			default:
-				panic("AI unimplemented: " + frame.card.name)
-			}
-			continue
+func (this SimpleBuyer) start(game *Game, p *Player) { playDecider(game, p, this) }
+
+func (this SimpleBuyer) Turn(game *Game, p *Player, d *Decision) Command {
+	if game.phase != phBuy {
+		return Command{s: "next"}
+	}
+	if c := handTreasure(game, p); c != nil {
+		return Command{s: "play", c: c}
+	}
+	for _, r := range this.rules {
+		c := r.card
+		if game.c >= game.Cost(c) && game.supply[c] > 0 && r.holds(game, p) {
+			return Command{s: "buy", c: c}
 		}
-		game.ch <- func() Command {
-			if game.phase == phAction {
-				return Command{s: "next"}
-			}
-			if game.phase != phBuy {
-				panic("unreachable")
-			}
-			for k := len(p.hand) - 1; k >= 0; k-- {
-				if p.hand[k].IsTreasure() {
-					return Command{s: "play", c: p.hand[k]}
-				}
-			}
-			for _, s := range this.list {
-				c := GetCard(s)
-				if game.c >= game.Cost(c) && c.supply > 0 {
-					return Command{s: "buy", c: c}
-				}
-			}
-			return Command{s: "next"}
-		}()
 	}
+	return Command{s: "next"}
 }
@@ -0,0 +1,48 @@
+package main
+
+// Spectators are remote clients without a seat. They are sent what the
+// players see of each other, so they never see a hand or a draw. A new
+// spectator waits until the next top-level command, when the game can be
+// sent as they see it.
+
+// Watch adds a spectator, whose messages arrive on w.recv.
+func (game *Game) Watch(w *Player) {
+	game.subMu.Lock()
+	defer game.subMu.Unlock()
+	game.pending = append(game.pending, w)
+}
+
+// Unwatch removes a spectator.
+func (game *Game) Unwatch(w *Player) {
+	game.subMu.Lock()
+	defer game.subMu.Unlock()
+	for _, list := range []*[]*Player{&game.watchers, &game.pending} {
+		for i, x := range *list {
+			if x == w {
+				*list = append((*list)[:i:i], (*list)[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// admit lets in the spectators waiting to watch, and returns them.
+func (game *Game) admit() []*Player {
+	game.subMu.Lock()
+	defer game.subMu.Unlock()
+	list := game.pending
+	game.pending = nil
+	game.watchers = append(game.watchers, list...)
+	return list
+}
+
+func (game *Game) watching() []*Player {
+	game.subMu.Lock()
+	defer game.subMu.Unlock()
+	return append([]*Player(nil), game.watchers...)
+}
+
+// recipients lists the players, then the spectators.
+func (game *Game) recipients() []*Player {
+	return append(game.seated(), game.watching()...)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpectate(t *testing.T) {
+	players := Setup(t, `
+= Alice =
+hand:Cellar,Estate,Copper
+deck:Silver
+= Bob =
+`)
+	game := newGame()
+	game.players = players
+	game.NewGame()
+	game.StartTurn(0)
+	alice := players[0]
+	w := &Player{recv: make(chan message, 100)}
+	game.Watch(w)
+	go game.resume()
+	<-alice.trigger
+	m := <-w.recv
+	if m.Type != "resume" || strings.Join(m.View.Players[0].Hand, ",") != "?,?,?" {
+		t.Fatalf("want resume without Alice's hand, got %+v", m)
+	}
+	if game.canUndo() {
+		t.Error("can undo while watched")
+	}
+	for _, cmd := range []Command{
+		{s: "play", c: GetCard("Cellar")},
+		{s: "pick", c: GetCard("Estate")},
+		{s: "done"},
+	} {
+		game.ch <- cmd
+		<-alice.trigger
+	}
+	var drew []string
+	for len(w.recv) > 0 {
+		if m := <-w.recv; m.Type == "draw" {
+			drew = append(drew, m.Cards...)
+		}
+	}
+	if want := "?"; strings.Join(drew, ",") != want {
+		t.Errorf("want draws %v, got %v", want, drew)
+	}
+}
+
+func TestUnwatch(t *testing.T) {
+	quit := make(chan bool)
+	ng := netGamer{in: make(chan Command), out: make(chan string), attach: make(chan chan message), rejoin: make(chan bool), quit: quit}
+	w := &Player{trigger: make(chan bool), recv: make(chan message), gone: quit}
+	game := newGame()
+	done := make(chan bool)
+	go func() {
+		ng.start(game, w)
+		close(done)
+	}()
+	stream := make(chan message)
+	ng.attach <- stream
+	close(quit)
+	if _, ok := <-stream; ok {
+		t.Error("stream still open")
+	}
+	<-done
+	game.send(w, message{Type: "chat"}) // Must not block.
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// standing is how one bot did in a tournament.
+type standing struct {
+	p      *Player
+	spec   string
+	games  int
+	points float64 // 1 for a win; a shared win is split.
+	vp     int
+}
+
+func (st *standing) rate() float64 { return st.points / float64(st.games) }
+
+// margin returns the half-width of the 95% confidence interval of rate.
+func (st *standing) margin() float64 {
+	r := st.rate()
+	return 1.96 * math.Sqrt(r*(1-r)/float64(st.games))
+}
+
+// add counts a game in which the bot got x, and the win, if any, was
+// shared by winners players.
+func (st *standing) add(x PlayerResult, winners int) {
+	st.games++
+	st.vp += x.score
+	if x.place == 1 {
+		st.points += 1 / float64(winners)
+	}
+}
+
+// league plays every pair of bots against each other on each preset,
+// once from each seat with each seed, and returns their standings, best
+// first. specs describe the bots.
+func league(game *Game, bots []*Player, specs []string, prs []*Preset, seeds []int64) []*standing {
+	var table []*standing
+	stats := make(map[*Player]*standing)
+	for i, p := range bots {
+		st := &standing{p: p, spec: specs[i]}
+		table = append(table, st)
+		stats[p] = st
+	}
+	for _, pr := range prs {
+		for i := range bots {
+			for j := i + 1; j < len(bots); j++ {
+				for _, s := range seeds {
+					for g := 0; g < 2; g++ {
+						r := simGame(game, rotate([]*Player{bots[i], bots[j]}, g), pr, s)
+						w := r.Winners()
+						for k, x := range r.players {
+							stats[game.players[k]].add(x, len(w))
+						}
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(table, func(i, j int) bool { return table[i].rate() > table[j].rate() })
+	return table
+}
+
+// tournament plays every pair of bots against each other on each preset,
+// and prints a league table. Each argument describes a bot; see newBot.
+func tournament(args []string) {
+	fs := flag.NewFlagSet("tournament", flag.ExitOnError)
+	n := fs.Int("n", 100, "deals per pairing on each preset, each played from both seats")
+	presetNames := fs.String("presets", "First Game", "comma-separated kingdom presets, or \"all\"")
+	seed := fs.Int64("seed", 0, "random seed; 0 picks one from the clock")
+	maxTurns := fs.Int("maxturns", 400, "end a game after this many turns in all")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gominion tournament [flags] bot bot...\n")
+		fmt.Fprint(os.Stderr, botUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var prs []*Preset
+	if *presetNames == "all" {
+		for i := range presets {
+			prs = append(prs, &presets[i])
+		}
+	} else {
+		for _, s := range strings.Split(*presetNames, ",") {
+			pr := findPreset(strings.TrimSpace(s))
+			if pr == nil {
+				log.Fatalf("no such preset: %q", s)
+			}
+			prs = append(prs, pr)
+		}
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	// Every pairing plays the same deals.
+	rng := rand.New(rand.NewSource(*seed))
+	seeds := make([]int64, *n)
+	for i := range seeds {
+		seeds[i] = rng.Int63()
+	}
+	game, bots, err := newSim(fs.Args(), *maxTurns, rng)
+	if err != nil {
+		log.Fatal(err)
+	}
+	table := league(game, bots, fs.Args(), prs, seeds)
+	fmt.Printf("%v games per pairing on %v preset(s), seed %v\n", 2**n, len(prs), *seed)
+	fmt.Printf("%4v %-4v %6v %14v %7v  %v\n", "", "bot", "games", "win%", "avg VP", "buys")
+	for k, st := range table {
+		fmt.Printf("%4v %-4v %6v %6.1f ± %5.1f %7.1f  %v\n", fmt.Sprintf("%v.", k+1), st.p.name, st.games,
+			100*st.rate(), 100*st.margin(), float64(st.vp)/float64(st.games), st.spec)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestLeague(t *testing.T) {
+	// Identical bots, each playing every deal from both seats, must
+	// split the points evenly.
+	specs := []string{"Province,Gold,Silver", "Province,Gold,Silver"}
+	game, bots, err := newSim(specs, 400, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := league(game, bots, specs, []*Preset{findPreset("Big Money")}, []int64{1, 2, 3})
+	if len(table) != 2 {
+		t.Fatalf("want 2 standings, got %v", len(table))
+	}
+	for _, st := range table {
+		if st.games != 6 || st.points != table[0].points {
+			t.Errorf("%v: want 6 games and %v points, got %v and %v", st.p.name, table[0].points, st.games, st.points)
+		}
+	}
+	if total := table[0].points + table[1].points; total != 6 {
+		t.Errorf("want 6 points in all, got %v", total)
+	}
+
+	var st standing
+	st.add(PlayerResult{score: 30, place: 1}, 2)
+	st.add(PlayerResult{score: 20, place: 2}, 1)
+	st.add(PlayerResult{score: 40, place: 1}, 1)
+	st.add(PlayerResult{score: 10, place: 2}, 1)
+	if st.games != 4 || st.points != 1.5 || st.vp != 100 {
+		t.Errorf("want 4 games, 1.5 points and 100 VP, got %+v", st)
+	}
+	for _, x := range []struct {
+		points       float64
+		games        int
+		rate, margin float64
+	}{
+		{5, 10, 0.5, 0.30990},
+		{90, 100, 0.9, 0.05880},
+		{4, 4, 1, 0},
+	} {
+		st := standing{points: x.points, games: x.games}
+		if math.Abs(st.rate()-x.rate) > 1e-4 || math.Abs(st.margin()-x.margin) > 1e-4 {
+			t.Errorf("%v of %v: want %v ± %v, got %v ± %v", x.points, x.games, x.rate, x.margin, st.rate(), st.margin())
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+// Undo works by rolling the game back to the last top-level command before
+// the command being taken back, then quietly redoing the commands in
+// between. Shuffles are redone from the log; everything else is
+// determined by the state of the game.
+//
+// A command cannot be taken back once hidden information has come out
+// after it, for example a card drawn or revealed.
+
+// undoPoint is a rollback point: the game before a top-level command, and
+// the commands and shuffles since.
+type undoPoint struct {
+	snap     *savedGame
+	cmds     []undoCmd
+	shuffles []Pile
+}
+
+type undoCmd struct {
+	p      *Player
+	cmd    Command
+	hidden int // Value of game.hidden after the command.
+}
+
+// rollback is the panic value that unwinds the game to a rollback point.
+type rollback struct {
+	snap *savedGame
+}
+
+// hide notes that hidden information has come out.
+func (game *Game) hide() { game.hidden++ }
+
+// canUndo reports whether undo is allowed. Remote clients, spectators
+// included, keep their own copy of the game, so only local games may be
+// rolled back.
+func (game *Game) canUndo() bool {
+	if !game.isServer || game.noUndo {
+		return false
+	}
+	for _, p := range game.players {
+		if p.recv != nil {
+			return false
+		}
+	}
+	return len(game.watching()) == 0
+}
+
+// markUndo adds a rollback point before a top-level command.
+func (game *Game) markUndo() {
+	if !game.canUndo() {
+		return
+	}
+	// Drop points that hidden information has made useless, except the
+	// latest of them, which explains why undo fails.
+	for len(game.undo) > 1 {
+		cmds := game.undo[1].cmds
+		if len(cmds) == 0 || cmds[len(cmds)-1].hidden == game.hidden {
+			break
+		}
+		game.undo = game.undo[1:]
+	}
+	snap, err := game.snapshot(nil)
+	if err != nil {
+		panic(err)
+	}
+	game.undo = append(game.undo, undoPoint{snap: snap})
+}
+
+// rollback takes back the last command of p. On success it does not
+// return; otherwise it returns the reason for failure.
+func (game *Game) rollback(p *Player) string {
+	if !game.canUndo() {
+		return "only local games can be undone"
+	}
+	for i := len(game.undo) - 1; i >= 0; i-- {
+		pt := game.undo[i]
+		for k := len(pt.cmds) - 1; k >= 0; k-- {
+			u := pt.cmds[k]
+			if u.hidden != game.hidden {
+				return "hidden information has been revealed"
+			}
+			if u.p != p || k == 0 && isForcedNext(pt.snap, u.cmd) {
+				continue
+			}
+			s := u.cmd.s
+			if u.cmd.c != nil {
+				s += " " + u.cmd.c.name
+			}
+			game.Printf("%v takes back %v\n", p.name, s)
+			game.record("cmd", p.n, "undo", 0, nil)
+			game.undo = game.undo[:i]
+			game.redo = nil
+			for _, x := range pt.cmds[:k] {
+				game.redo = append(game.redo, x.cmd)
+			}
+			game.redoShuffles = pt.shuffles
+			game.quiet = len(game.redo) > 0
+			panic(rollback{pt.snap})
+		}
+	}
+	return "nothing to undo"
+}
+
+// isForcedNext reports whether cmd ends an action phase without any
+// Action to play, as consoleGamer does unprompted.
+func isForcedNext(snap *savedGame, cmd Command) bool {
+	if cmd.s != "next" || snap.Phase != phAction {
+		return false
+	}
+	for _, s := range snap.Players[snap.Player].Hand {
+		if c := CardDict[s]; c != nil && c.IsAction() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUndoPick(t *testing.T) {
+	players := Setup(t, `
+= Alice =
+hand:Cellar,Estate,Duchy,Copper
+deck:Silver,Gold
+= Bob =
+`)
+	game := newGame()
+	game.players = players
+	game.NewGame()
+	game.StartTurn(0)
+	events := game.Subscribe()
+	go game.resume()
+	alice := players[0]
+	for _, cmd := range []Command{
+		{s: "undo"},
+		{s: "play", c: GetCard("Cellar")},
+		{s: "pick", c: GetCard("Estate")},
+		{s: "undo"},
+		{s: "pick", c: GetCard("Duchy")},
+		{s: "done"},
+	} {
+		<-alice.trigger
+		game.ch <- cmd
+	}
+	<-alice.trigger
+	CheckPiles(t, players, `
+= Alice =
+hand:Estate,Copper,Silver
+deck:Gold
+played:Cellar
+discard:Duchy
+`)
+	var refused []RefusedEvent
+	drainEvents(events, func(ev Event) {
+		switch ev := ev.(type) {
+		case RefusedEvent:
+			refused = append(refused, ev)
+		case TextEvent:
+			if strings.Contains(ev.s, "cannot undo") {
+				t.Errorf("refusal sent to everyone: %q", ev.s)
+			}
+		}
+	})
+	if want := (RefusedEvent{0, "cannot undo: nothing to undo"}); len(refused) != 1 || refused[0] != want {
+		t.Errorf("want %+v, got %+v", want, refused)
+	}
+}
@@ -0,0 +1,266 @@
+// play.js plays a seat at a table of the game server from a browser. It
+// keeps no copy of the game: the server sends it views and what is asked,
+// as described in protocol.go.
+"use strict";
+
+const version = 1;
+const phases = ["Setup", "Action", "Buy", "Cleanup"];
+
+let seat = JSON.parse(sessionStorage.getItem("seat") || "null");
+let stream = null;
+let view = null;  // The game as this seat sees it.
+let costs = {};
+let ask = null;   // What the server waits for, or null.
+
+function $(id) { return document.getElementById(id); }
+
+function el(tag, text) {
+  const e = document.createElement(tag);
+  if (text !== undefined) e.textContent = text;
+  return e;
+}
+
+function button(text, onclick) {
+  const b = el("button", text);
+  b.type = "button";
+  b.onclick = onclick;
+  return b;
+}
+
+function query() {
+  return "?table=" + seat.table + "&id=" + encodeURIComponent(seat.name) + "&token=" + seat.token;
+}
+
+async function post(path, body) {
+  const resp = await fetch(path, {method: "POST", body: JSON.stringify(body)});
+  return resp.json();
+}
+
+function say(text) {
+  const log = $("log");
+  log.append(el("div", text));
+  log.scrollTop = log.scrollHeight;
+}
+
+function saveSeat() {
+  sessionStorage.setItem("seat", JSON.stringify(seat));
+}
+
+// join sits at a table, or at the seat of this page before a reload.
+async function join(path, h) {
+  h.Version = version;
+  h.Views = true;
+  const rep = await post(path, h);
+  if (rep.Error) {
+    return rep.Error;
+  }
+  seat = {name: h.Name, table: rep.Table, token: rep.Token};
+  saveSeat();
+  $("join").classList.add("hidden");
+  $("game").classList.remove("hidden");
+  say("Joined table " + seat.table + ".");
+  listen();
+  return "";
+}
+
+function listen() {
+  if (stream) stream.close();
+  stream = new EventSource("/events" + query());
+  stream.onmessage = e => handle(JSON.parse(e.data));
+  stream.onerror = () => {
+    // The token in the stream's URL may be stale, so ask for a new one.
+    stream.close();
+    stream = null;
+    setTimeout(rejoin, 1000);
+  };
+}
+
+async function rejoin() {
+  let err;
+  try {
+    err = await join("/reconnect", {Name: seat.name, Table: seat.table, Token: seat.token});
+  } catch (e) {
+    err = "the server is gone";
+  }
+  if (err) {
+    alert("Cannot rejoin: " + err);
+    sessionStorage.removeItem("seat");
+    $("game").classList.add("hidden");
+    $("join").classList.remove("hidden");
+  }
+}
+
+function handle(m) {
+  switch (m.Type) {
+  case "new":
+    view = {Turn: 0, Player: 0, Phase: 1, A: 0, B: 0, C: 0, Supply: m.Supply,
+      Players: m.Players.map(name => ({Name: name, Hand: name == seat.name ? m.Hand : []}))};
+    say("A game starts.");
+    break;
+  case "resume":
+  case "view":
+    view = m.View;
+    break;
+  case "go":
+    if (m.View) view = m.View;
+    if (m.Costs) costs = m.Costs;
+    ask = m.Ask || null;
+    $("error").textContent = "";
+    if (ask && ask.Kind == "top" && view.Phase == 1 && !ask.Options) {
+      // Move on to buying when there is no action to play.
+      send({Cmd: "next"});
+      return;
+    }
+    break;
+  case "error":
+    $("error").textContent = m.Error;
+    break;
+  case "chat":
+    say("<" + m.From + "> " + m.Text);
+    break;
+  case "token":
+    seat.token = m.Token;
+    saveSeat();
+    say("The game is over.");
+    break;
+  }
+  render();
+}
+
+async function send(cmd) {
+  ask = null;
+  render();
+  const rep = await post("/cmd" + query(), cmd);
+  if (rep.Error) $("error").textContent = rep.Error;
+}
+
+function cardButton(name, label, onclick) {
+  const b = button(label || name, onclick);
+  b.className = "card";
+  b.disabled = !onclick;
+  return b;
+}
+
+// offered says whether name is among the cards that may be picked.
+function offered(name) {
+  return ask && ask.Options && ask.Options.includes(name);
+}
+
+function me() {
+  return view.Players.find(p => p.Name == seat.name);
+}
+
+function render() {
+  if (!view) return;
+  const supply = $("supply");
+  supply.replaceChildren();
+  for (const s of view.Supply || []) {
+    let click = null;
+    if (ask && ask.Kind == "top") {
+      click = () => send({Cmd: "buy", Card: s.Card});
+    } else if (ask && ask.Kind == "supply" && offered(s.Card)) {
+      click = () => send({Cmd: "pick", Card: s.Card});
+    }
+    const cost = s.Card in costs ? " $" + costs[s.Card] : "";
+    const b = cardButton(s.Card, s.Card + cost + " ", click);
+    b.append(el("span", "(" + s.Count + ")"));
+    b.lastChild.className = "count";
+    supply.append(b);
+  }
+
+  const players = $("players");
+  players.replaceChildren();
+  const head = el("tr");
+  for (const s of ["", "Player", "Deck", "Hand", "Discard"]) head.append(el("th", s));
+  players.append(head);
+  view.Players.forEach((p, i) => {
+    const row = el("tr");
+    for (const s of [i == view.Player ? "▶" : "", p.Name, (p.Deck || []).length,
+      (p.Hand || []).length, (p.Discard || []).length]) {
+      row.append(el("td", s));
+    }
+    players.append(row);
+  });
+
+  const current = view.Players[view.Player];
+  $("status").textContent = "Turn " + view.Turn + ": " + current.Name + ", " + phases[view.Phase] +
+    " phase. Actions " + view.A + ", buys " + view.B + ", $" + view.C;
+  const played = $("played");
+  played.replaceChildren();
+  for (const name of current.Played || []) played.append(cardButton(name));
+
+  const hand = $("hand");
+  hand.replaceChildren();
+  for (const name of me() ? me().Hand || [] : []) {
+    let click = null;
+    if (ask && (ask.Kind == "top" || ask.Kind == "split") && offered(name)) {
+      click = () => send({Cmd: ask.Kind == "top" ? "play" : "pick", Card: name});
+    }
+    hand.append(cardButton(name, name, click));
+  }
+
+  renderAsk();
+}
+
+function renderAsk() {
+  const prompt = $("prompt");
+  const options = $("options");
+  options.replaceChildren();
+  if (!ask) {
+    prompt.textContent = "Waiting for others.";
+    return;
+  }
+  let text = ask.Prompt || "";
+  if (ask.Card) text = ask.Card + ": " + text;
+  switch (ask.Kind) {
+  case "setup":
+    prompt.textContent = "Pick a preset, then start.";
+    ask.Names.forEach((name, i) => options.append(button(name, () => send({Cmd: "preset", N: i}))));
+    options.append(button("Random kingdom", () => send({Cmd: "random"})));
+    options.append(button("Start", () => send({Cmd: "start"})));
+    return;
+  case "top":
+    prompt.textContent = "Play or buy a card.";
+    options.append(button("Next phase", () => send({Cmd: "next"})));
+    return;
+  case "split":
+    for (const name of ask.Options || []) {
+      options.append(cardButton(name, name, () => send({Cmd: "pick", Card: name})));
+    }
+    if (!ask.Exact) options.append(button("Done", () => send({Cmd: "done"})));
+    break;
+  case "supply":
+    for (const name of ask.Options || []) {
+      options.append(cardButton(name, name, () => send({Cmd: "pick", Card: name})));
+    }
+    if (ask.Optional) options.append(button("Nothing", () => send({Cmd: "pick"})));
+    break;
+  case "bool":
+    if (ask.Shown) text += " " + ask.Shown.join(", ");
+    options.append(button("Yes", () => send({Cmd: "yes"})));
+    options.append(button("No", () => send({Cmd: "done"})));
+    break;
+  case "choose":
+    ask.Names.forEach((name, i) => options.append(button(name, () => send({Cmd: String(i + 1)}))));
+    break;
+  }
+  prompt.textContent = text;
+}
+
+$("join").onsubmit = async e => {
+  e.preventDefault();
+  const err = await join("/reg", {Name: $("name").value, Table: Number($("table").value)});
+  if (err) alert(err);
+};
+
+$("chat").onsubmit = async e => {
+  e.preventDefault();
+  const rep = await post("/chat" + query(), {Text: $("line").value});
+  if (rep.Error) {
+    $("error").textContent = rep.Error;
+  } else {
+    $("line").value = "";
+  }
+};
+
+if (seat) rejoin();